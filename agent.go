@@ -0,0 +1,369 @@
+package proxmox
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// GuestAgent talks to the QEMU guest agent running inside a VM. The agent
+// has to be enabled in the VM configuration and running in the guest.
+type GuestAgent struct {
+	qemu QemuVM
+}
+
+// AgentExecStatus is the state of a command started with Exec. OutData and
+// ErrData hold what the command wrote to stdout and stderr so far.
+type AgentExecStatus struct {
+	Exited       bool
+	ExitCode     int
+	Signal       int
+	OutData      string
+	ErrData      string
+	OutTruncated bool
+	ErrTruncated bool
+}
+
+type AgentInterface struct {
+	Name            string
+	HardwareAddress string
+	IPAddresses     []AgentIPAddress
+}
+
+type AgentIPAddress struct {
+	Address string
+	Type    string
+	Prefix  int
+}
+
+type AgentOSInfo struct {
+	Id            string
+	Name          string
+	PrettyName    string
+	Version       string
+	VersionId     string
+	KernelRelease string
+	KernelVersion string
+	Machine       string
+}
+
+type AgentFilesystem struct {
+	Name       string
+	Mountpoint string
+	Type       string
+	TotalBytes float64
+	UsedBytes  float64
+}
+
+type agentExecStatusData struct {
+	Exited       flexFloat  `json:"exited"`
+	ExitCode     flexFloat  `json:"exitcode"`
+	Signal       flexFloat  `json:"signal"`
+	OutData      flexString `json:"out-data"`
+	ErrData      flexString `json:"err-data"`
+	OutTruncated flexFloat  `json:"out-truncated"`
+	ErrTruncated flexFloat  `json:"err-truncated"`
+}
+
+type agentInterfaceData struct {
+	Name            string `json:"name"`
+	HardwareAddress string `json:"hardware-address"`
+	IPAddresses     []struct {
+		Address string    `json:"ip-address"`
+		Type    string    `json:"ip-address-type"`
+		Prefix  flexFloat `json:"prefix"`
+	} `json:"ip-addresses"`
+}
+
+type agentOSInfoData struct {
+	Id            string `json:"id"`
+	Name          string `json:"name"`
+	PrettyName    string `json:"pretty-name"`
+	Version       string `json:"version"`
+	VersionId     string `json:"version-id"`
+	KernelRelease string `json:"kernel-release"`
+	KernelVersion string `json:"kernel-version"`
+	Machine       string `json:"machine"`
+}
+
+type agentFilesystemData struct {
+	Name       string    `json:"name"`
+	Mountpoint string    `json:"mountpoint"`
+	Type       string    `json:"type"`
+	TotalBytes flexFloat `json:"total-bytes"`
+	UsedBytes  flexFloat `json:"used-bytes"`
+}
+
+func (qemu QemuVM) Agent() GuestAgent {
+	return GuestAgent{qemu: qemu}
+}
+
+func (agent GuestAgent) endpoint(command string) string {
+	return "nodes/" + agent.qemu.Node.Node + "/qemu/" + strconv.FormatFloat(agent.qemu.VMId, 'f', 0, 64) + "/agent/" + command
+}
+
+// do runs an agent command. Most commands wrap their answer in a result
+// member, which is decoded into out.
+func (agent GuestAgent) do(ctx context.Context, method string, command string, params url.Values, out interface{}) error {
+	var result struct {
+		Result json.RawMessage `json:"result"`
+	}
+	var err error
+
+	if out == nil {
+		return agent.qemu.Node.Proxmox.Do(ctx, method, agent.endpoint(command), params, nil)
+	}
+	err = agent.qemu.Node.Proxmox.Do(ctx, method, agent.endpoint(command), params, &result)
+	if err != nil {
+		return err
+	}
+	if len(result.Result) == 0 {
+		return errors.New("No result from guest agent command " + command + ".")
+	}
+	return json.Unmarshal(result.Result, out)
+}
+
+func (agent GuestAgent) Ping() error {
+	return agent.PingCtx(context.Background())
+}
+
+// PingCtx returns an error if the agent does not answer.
+func (agent GuestAgent) PingCtx(ctx context.Context) error {
+	return agent.do(ctx, "POST", "ping", nil, nil)
+}
+
+func (agent GuestAgent) Exec(command []string, input string) (int, error) {
+	return agent.ExecCtx(context.Background(), command, input)
+}
+
+// ExecCtx starts the command in the guest and returns its PID. The first
+// element of command is the program, the others are its arguments. Input is
+// passed to the command on stdin.
+func (agent GuestAgent) ExecCtx(ctx context.Context, command []string, input string) (int, error) {
+	var form url.Values
+	var result struct {
+		PID flexFloat `json:"pid"`
+	}
+	var err error
+
+	if len(command) == 0 {
+		return 0, errors.New("No command given.")
+	}
+	form = url.Values{"command": command}
+	if input != "" {
+		form.Set("input-data", input)
+	}
+	err = agent.qemu.Node.Proxmox.Do(ctx, "POST", agent.endpoint("exec"), form, &result)
+	if err != nil {
+		return 0, err
+	}
+	return int(result.PID), nil
+}
+
+func (agent GuestAgent) ExecStatus(pid int) (AgentExecStatus, error) {
+	return agent.ExecStatusCtx(context.Background(), pid)
+}
+
+func (agent GuestAgent) ExecStatusCtx(ctx context.Context, pid int) (AgentExecStatus, error) {
+	var data agentExecStatusData
+	var err error
+
+	err = agent.qemu.Node.Proxmox.Do(ctx, "GET", agent.endpoint("exec-status"), url.Values{"pid": {strconv.Itoa(pid)}}, &data)
+	if err != nil {
+		return AgentExecStatus{}, err
+	}
+	return AgentExecStatus{
+		Exited:       data.Exited != 0,
+		ExitCode:     int(data.ExitCode),
+		Signal:       int(data.Signal),
+		OutData:      string(data.OutData),
+		ErrData:      string(data.ErrData),
+		OutTruncated: data.OutTruncated != 0,
+		ErrTruncated: data.ErrTruncated != 0,
+	}, nil
+}
+
+func (agent GuestAgent) Run(command []string, input string, timeout int) (AgentExecStatus, error) {
+	return agent.RunCtx(context.Background(), command, input, timeout)
+}
+
+// RunCtx executes the command and polls its status every second until it
+// exited, at most timeout seconds. A timeout of 0 or less waits until the
+// command exited or ctx is done.
+func (agent GuestAgent) RunCtx(ctx context.Context, command []string, input string, timeout int) (AgentExecStatus, error) {
+	var pid int
+	var status AgentExecStatus
+	var err error
+	var i int
+
+	pid, err = agent.ExecCtx(ctx, command, input)
+	if err != nil {
+		return status, err
+	}
+	for i = 0; timeout <= 0 || i < timeout; i++ {
+		status, err = agent.ExecStatusCtx(ctx, pid)
+		if err != nil || status.Exited {
+			return status, err
+		}
+		err = sleepCtx(ctx, time.Second*1)
+		if err != nil {
+			return status, err
+		}
+	}
+	return status, errors.New("Timeout reached")
+}
+
+func (agent GuestAgent) FileRead(file string) (string, bool, error) {
+	return agent.FileReadCtx(context.Background(), file)
+}
+
+// FileReadCtx returns the content of the file and whether it was truncated,
+// which happens above 16 MiB.
+func (agent GuestAgent) FileReadCtx(ctx context.Context, file string) (string, bool, error) {
+	var result struct {
+		Content   string    `json:"content"`
+		Truncated flexFloat `json:"truncated"`
+	}
+	var err error
+
+	err = agent.qemu.Node.Proxmox.Do(ctx, "GET", agent.endpoint("file-read"), url.Values{"file": {file}}, &result)
+	if err != nil {
+		return "", false, err
+	}
+	return result.Content, result.Truncated != 0, nil
+}
+
+func (agent GuestAgent) FileWrite(file string, content string) error {
+	return agent.FileWriteCtx(context.Background(), file, content)
+}
+
+func (agent GuestAgent) FileWriteCtx(ctx context.Context, file string, content string) error {
+	return agent.qemu.Node.Proxmox.Do(ctx, "POST", agent.endpoint("file-write"), url.Values{
+		"file":    {file},
+		"content": {content},
+	}, nil)
+}
+
+func (agent GuestAgent) NetworkInterfaces() ([]AgentInterface, error) {
+	return agent.NetworkInterfacesCtx(context.Background())
+}
+
+func (agent GuestAgent) NetworkInterfacesCtx(ctx context.Context) ([]AgentInterface, error) {
+	var results []agentInterfaceData
+	var interfaces []AgentInterface
+	var err error
+
+	err = agent.do(ctx, "GET", "network-get-interfaces", nil, &results)
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range results {
+		iface := AgentInterface{Name: v.Name, HardwareAddress: v.HardwareAddress}
+		for _, ip := range v.IPAddresses {
+			iface.IPAddresses = append(iface.IPAddresses, AgentIPAddress{Address: ip.Address, Type: ip.Type, Prefix: int(ip.Prefix)})
+		}
+		interfaces = append(interfaces, iface)
+	}
+	return interfaces, nil
+}
+
+func (agent GuestAgent) OSInfo() (AgentOSInfo, error) {
+	return agent.OSInfoCtx(context.Background())
+}
+
+func (agent GuestAgent) OSInfoCtx(ctx context.Context) (AgentOSInfo, error) {
+	var result agentOSInfoData
+	var err error
+
+	err = agent.do(ctx, "GET", "get-osinfo", nil, &result)
+	if err != nil {
+		return AgentOSInfo{}, err
+	}
+	return AgentOSInfo(result), nil
+}
+
+func (agent GuestAgent) FSInfo() ([]AgentFilesystem, error) {
+	return agent.FSInfoCtx(context.Background())
+}
+
+func (agent GuestAgent) FSInfoCtx(ctx context.Context) ([]AgentFilesystem, error) {
+	var results []agentFilesystemData
+	var filesystems []AgentFilesystem
+	var err error
+
+	err = agent.do(ctx, "GET", "get-fsinfo", nil, &results)
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range results {
+		filesystems = append(filesystems, AgentFilesystem{
+			Name:       v.Name,
+			Mountpoint: v.Mountpoint,
+			Type:       v.Type,
+			TotalBytes: float64(v.TotalBytes),
+			UsedBytes:  float64(v.UsedBytes),
+		})
+	}
+	return filesystems, nil
+}
+
+func (agent GuestAgent) FSFreeze() (int, error) {
+	return agent.FSFreezeCtx(context.Background())
+}
+
+// FSFreezeCtx freezes all guest filesystems and returns their number.
+func (agent GuestAgent) FSFreezeCtx(ctx context.Context) (int, error) {
+	var result flexFloat
+	var err error
+
+	err = agent.do(ctx, "POST", "fsfreeze-freeze", nil, &result)
+	return int(result), err
+}
+
+func (agent GuestAgent) FSThaw() (int, error) {
+	return agent.FSThawCtx(context.Background())
+}
+
+// FSThawCtx thaws all guest filesystems and returns their number.
+func (agent GuestAgent) FSThawCtx(ctx context.Context) (int, error) {
+	var result flexFloat
+	var err error
+
+	err = agent.do(ctx, "POST", "fsfreeze-thaw", nil, &result)
+	return int(result), err
+}
+
+func (agent GuestAgent) FSFreezeStatus() (string, error) {
+	return agent.FSFreezeStatusCtx(context.Background())
+}
+
+// FSFreezeStatusCtx returns "frozen" or "thawed".
+func (agent GuestAgent) FSFreezeStatusCtx(ctx context.Context) (string, error) {
+	var result flexString
+	var err error
+
+	err = agent.do(ctx, "POST", "fsfreeze-status", nil, &result)
+	return string(result), err
+}
+
+func (agent GuestAgent) SetUserPassword(username string, password string, crypted bool) error {
+	return agent.SetUserPasswordCtx(context.Background(), username, password, crypted)
+}
+
+// SetUserPasswordCtx sets the password of a guest user. If crypted is set,
+// password is already hashed as expected by the guest, e.g. by crypt(3).
+func (agent GuestAgent) SetUserPasswordCtx(ctx context.Context, username string, password string, crypted bool) error {
+	var form url.Values
+
+	form = url.Values{
+		"username": {username},
+		"password": {password},
+	}
+	if crypted {
+		form.Set("crypted", "1")
+	}
+	return agent.qemu.Node.Proxmox.Do(ctx, "POST", agent.endpoint("set-user-password"), form, nil)
+}
@@ -0,0 +1,151 @@
+package proxmox
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/joernott/go-proxmox/proxmoxtest"
+)
+
+func newAgentServer(t *testing.T) (*proxmoxtest.Server, GuestAgent) {
+	t.Helper()
+	srv := newTestServer(t)
+	srv.AddVM(proxmoxtest.VM{VMID: 100, Status: "running", Config: map[string]string{"agent": "1"}})
+	srv.Exec = func(vm proxmoxtest.VM, command []string, input string) (int, string, string) {
+		if command[0] == "cat" {
+			return 0, input, ""
+		}
+		return 2, "", command[0] + ": not found\n"
+	}
+	proxmox := newTestClient(t, srv)
+	qemu, err := proxmox.FindVM("100")
+	if err != nil {
+		t.Fatalf("FindVM: %v", err)
+	}
+	return srv, qemu.Agent()
+}
+
+func TestAgentExec(t *testing.T) {
+	_, agent := newAgentServer(t)
+
+	pid, err := agent.Exec([]string{"cat"}, "hello\n")
+	if err != nil {
+		t.Fatalf("Exec: %v", err)
+	}
+	status, err := agent.ExecStatus(pid)
+	if err != nil {
+		t.Fatalf("ExecStatus: %v", err)
+	}
+	want := AgentExecStatus{Exited: true, OutData: "hello\n"}
+	if status != want {
+		t.Errorf("ExecStatus = %+v, want %+v", status, want)
+	}
+
+	pid, err = agent.Exec([]string{"nosuch", "-v"}, "")
+	if err != nil {
+		t.Fatalf("Exec: %v", err)
+	}
+	status, err = agent.ExecStatus(pid)
+	if err != nil {
+		t.Fatalf("ExecStatus: %v", err)
+	}
+	want = AgentExecStatus{Exited: true, ExitCode: 2, ErrData: "nosuch: not found\n"}
+	if status != want {
+		t.Errorf("ExecStatus = %+v, want %+v", status, want)
+	}
+
+	if _, err = agent.Exec(nil, ""); err == nil {
+		t.Error("Exec without command: got no error")
+	}
+	if _, err = agent.ExecStatus(9999); err == nil {
+		t.Error("ExecStatus of an unknown PID: got no error")
+	}
+}
+
+func TestAgentRun(t *testing.T) {
+	srv, agent := newAgentServer(t)
+	srv.ExecDuration = time.Millisecond * 1500
+
+	status, err := agent.Run([]string{"cat"}, "polled\n", 5)
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if !status.Exited || status.OutData != "polled\n" {
+		t.Errorf("Run = %+v, want the output after exiting", status)
+	}
+
+	status, err = agent.Run([]string{"cat"}, "", 1)
+	if err == nil || status.Exited {
+		t.Errorf("Run with a timeout of 1s: got %+v, %v, want a timeout", status, err)
+	}
+
+	// Without timeout, Run waits for the context.
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*500)
+	defer cancel()
+	_, err = agent.RunCtx(ctx, []string{"cat"}, "", 0)
+	if err != context.DeadlineExceeded {
+		t.Errorf("RunCtx without timeout: got %v, want %v", err, context.DeadlineExceeded)
+	}
+	status, err = agent.RunCtx(context.Background(), []string{"cat"}, "waited\n", 0)
+	if err != nil || status.OutData != "waited\n" {
+		t.Errorf("RunCtx without timeout: got %+v, %v", status, err)
+	}
+}
+
+func TestAgentFiles(t *testing.T) {
+	srv, agent := newAgentServer(t)
+
+	if err := agent.FileWrite("/etc/motd", "welcome\n"); err != nil {
+		t.Fatalf("FileWrite: %v", err)
+	}
+	if vm, _ := srv.VM(100); vm.Files["/etc/motd"] != "welcome\n" {
+		t.Errorf("file in the guest = %q, want welcome", vm.Files["/etc/motd"])
+	}
+	content, truncated, err := agent.FileRead("/etc/motd")
+	if err != nil {
+		t.Fatalf("FileRead: %v", err)
+	}
+	if content != "welcome\n" || truncated {
+		t.Errorf("FileRead = %q, truncated %v", content, truncated)
+	}
+	if _, _, err = agent.FileRead("/etc/nosuch"); err == nil {
+		t.Error("FileRead of a missing file: got no error")
+	}
+}
+
+func TestAgentUnavailable(t *testing.T) {
+	srv := newTestServer(t)
+	srv.AddVM(proxmoxtest.VM{VMID: 100, Status: "running"})
+	srv.AddVM(proxmoxtest.VM{VMID: 101, Status: "stopped", Config: map[string]string{"agent": "1"}})
+	proxmox := newTestClient(t, srv)
+
+	for _, vmid := range []string{"100", "101"} {
+		qemu, err := proxmox.FindVM(vmid)
+		if err != nil {
+			t.Fatalf("FindVM: %v", err)
+		}
+		if err = qemu.Agent().Ping(); err == nil {
+			t.Errorf("Ping of %s: got no error", vmid)
+		}
+	}
+}
+
+func TestAgentInfo(t *testing.T) {
+	_, agent := newAgentServer(t)
+
+	interfaces, err := agent.NetworkInterfaces()
+	if err != nil {
+		t.Fatalf("NetworkInterfaces: %v", err)
+	}
+	want := []AgentInterface{{Name: "eth0", HardwareAddress: "bc:24:11:00:00:64",
+		IPAddresses: []AgentIPAddress{{Address: "10.0.0.100", Type: "ipv4", Prefix: 24}}}}
+	if !reflect.DeepEqual(interfaces, want) {
+		t.Errorf("NetworkInterfaces = %+v, want %+v", interfaces, want)
+	}
+	info, err := agent.OSInfo()
+	if err != nil || info.Id != "debian" {
+		t.Errorf("OSInfo = %+v, %v", info, err)
+	}
+}
@@ -0,0 +1,206 @@
+package proxmox
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// CloudInit is the cloud-init configuration of a VM. IPConfig is keyed by
+// the index of the network device, e.g. 0 for net0, empty entries are not
+// set. Custom references
+// snippets replacing the generated data, e.g. "user=local:snippets/user.yaml".
+// Type is one of "nocloud", "configdrive2" or "opennebula".
+type CloudInit struct {
+	User         string
+	Password     string
+	SSHKeys      []string
+	IPConfig     map[int]CloudInitIPConfig
+	Nameserver   string
+	SearchDomain string
+	Custom       string
+	Type         string
+	Upgrade      *bool
+}
+
+// CloudInitIPConfig configures one network device. IP and IP6 are addresses
+// in CIDR notation or "dhcp", IP6 may also be "auto".
+type CloudInitIPConfig struct {
+	IP       string
+	Gateway  string
+	IP6      string
+	Gateway6 string
+}
+
+func (ip CloudInitIPConfig) String() string {
+	var parts []string
+
+	if ip.IP != "" {
+		parts = append(parts, "ip="+ip.IP)
+	}
+	if ip.Gateway != "" {
+		parts = append(parts, "gw="+ip.Gateway)
+	}
+	if ip.IP6 != "" {
+		parts = append(parts, "ip6="+ip.IP6)
+	}
+	if ip.Gateway6 != "" {
+		parts = append(parts, "gw6="+ip.Gateway6)
+	}
+	return strings.Join(parts, ",")
+}
+
+// encodeSSHKeys encodes the keys the way the API expects them: the value is
+// URL encoded once more on top of the form encoding, with spaces as %20.
+func encodeSSHKeys(keys []string) string {
+	return strings.ReplaceAll(url.QueryEscape(strings.Join(keys, "\n")), "+", "%20")
+}
+
+func decodeSSHKeys(data string) []string {
+	var keys []string
+
+	decoded, err := url.QueryUnescape(data)
+	if err != nil {
+		decoded = data
+	}
+	for _, key := range strings.Split(decoded, "\n") {
+		if strings.TrimSpace(key) != "" {
+			keys = append(keys, strings.TrimSpace(key))
+		}
+	}
+	return keys
+}
+
+func (ci CloudInit) changes() map[string]string {
+	var changes map[string]string
+
+	changes = make(map[string]string)
+	if ci.User != "" {
+		changes["ciuser"] = ci.User
+	}
+	if ci.Password != "" {
+		changes["cipassword"] = ci.Password
+	}
+	if len(ci.SSHKeys) > 0 {
+		changes["sshkeys"] = encodeSSHKeys(ci.SSHKeys)
+	}
+	for i, ip := range ci.IPConfig {
+		// An empty ipconfig would be sent as "", which the API rejects.
+		if ip == (CloudInitIPConfig{}) {
+			continue
+		}
+		changes["ipconfig"+strconv.Itoa(i)] = ip.String()
+	}
+	if ci.Nameserver != "" {
+		changes["nameserver"] = ci.Nameserver
+	}
+	if ci.SearchDomain != "" {
+		changes["searchdomain"] = ci.SearchDomain
+	}
+	if ci.Custom != "" {
+		changes["cicustom"] = ci.Custom
+	}
+	if ci.Type != "" {
+		changes["citype"] = ci.Type
+	}
+	if ci.Upgrade != nil {
+		changes["ciupgrade"] = boolString(*ci.Upgrade)
+	}
+	return changes
+}
+
+func (qemu QemuVM) SetCloudInit(ci CloudInit) error {
+	return qemu.SetCloudInitCtx(context.Background(), ci)
+}
+
+// SetCloudInitCtx changes the cloud-init settings which are set in ci, the
+// others are left as they are. The cloud-init drive is regenerated on the
+// next start, or with RegenerateCloudInit.
+func (qemu QemuVM) SetCloudInitCtx(ctx context.Context, ci CloudInit) error {
+	var changes map[string]string
+
+	changes = ci.changes()
+	if len(changes) == 0 {
+		return errors.New("No cloud-init settings for VM " + strconv.FormatFloat(qemu.VMId, 'f', 0, 64) + ".")
+	}
+	return qemu.UpdateConfigCtx(ctx, changes, nil, "")
+}
+
+func (qemu QemuVM) CloudInit() (CloudInit, error) {
+	return qemu.CloudInitCtx(context.Background())
+}
+
+// CloudInitCtx reads the cloud-init settings from the VM configuration. The
+// API does not return the password, only a placeholder if one is set.
+func (qemu QemuVM) CloudInitCtx(ctx context.Context) (CloudInit, error) {
+	var config QemuConfig
+	var ci CloudInit
+	var i int
+	var err error
+
+	config, err = qemu.ConfigCtx(ctx)
+	if err != nil {
+		return ci, err
+	}
+	ci = CloudInit{
+		User:         config.Raw["ciuser"],
+		Password:     config.Raw["cipassword"],
+		SSHKeys:      decodeSSHKeys(config.Raw["sshkeys"]),
+		IPConfig:     make(map[int]CloudInitIPConfig),
+		Nameserver:   config.Raw["nameserver"],
+		SearchDomain: config.Raw["searchdomain"],
+		Custom:       config.Raw["cicustom"],
+		Type:         config.Raw["citype"],
+	}
+	if upgrade, ok := config.Raw["ciupgrade"]; ok {
+		ci.Upgrade = new(bool)
+		*ci.Upgrade = upgrade == "1"
+	}
+	for k, options := range config.IPConfig {
+		i, err = strconv.Atoi(strings.TrimPrefix(k, "ipconfig"))
+		if err != nil {
+			continue
+		}
+		ci.IPConfig[i] = CloudInitIPConfig{
+			IP:       options["ip"],
+			Gateway:  options["gw"],
+			IP6:      options["ip6"],
+			Gateway6: options["gw6"],
+		}
+	}
+	return ci, nil
+}
+
+func (qemu QemuVM) RegenerateCloudInit() error {
+	return qemu.RegenerateCloudInitCtx(context.Background())
+}
+
+// RegenerateCloudInitCtx rebuilds the cloud-init drive with the current
+// settings while the VM is running.
+func (qemu QemuVM) RegenerateCloudInitCtx(ctx context.Context) error {
+	return qemu.Node.Proxmox.Do(ctx, "PUT", "nodes/"+qemu.Node.Node+"/qemu/"+strconv.FormatFloat(qemu.VMId, 'f', 0, 64)+"/cloudinit", nil, nil)
+}
+
+func (qemu QemuVM) CloudInitDump(dumpType string) (string, error) {
+	return qemu.CloudInitDumpCtx(context.Background(), dumpType)
+}
+
+// CloudInitDumpCtx returns the generated cloud-init data of dumpType "user",
+// "network" or "meta".
+func (qemu QemuVM) CloudInitDumpCtx(ctx context.Context, dumpType string) (string, error) {
+	var dump flexString
+	var err error
+
+	switch dumpType {
+	case "user", "network", "meta":
+	default:
+		return "", errors.New("Invalid cloud-init dump type " + dumpType + ".")
+	}
+	err = qemu.Node.Proxmox.Do(ctx, "GET", "nodes/"+qemu.Node.Node+"/qemu/"+strconv.FormatFloat(qemu.VMId, 'f', 0, 64)+"/cloudinit/dump", url.Values{"type": {dumpType}}, &dump)
+	if err != nil {
+		return "", err
+	}
+	return string(dump), nil
+}
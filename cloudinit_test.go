@@ -0,0 +1,80 @@
+package proxmox
+
+import (
+	"testing"
+
+	"github.com/joernott/go-proxmox/proxmoxtest"
+)
+
+func TestCloudInitRoundTrip(t *testing.T) {
+	srv := newTestServer(t)
+	srv.AddVM(proxmoxtest.VM{VMID: 100})
+	proxmox := newTestClient(t, srv)
+	qemu, err := proxmox.FindVM("100")
+	if err != nil {
+		t.Fatalf("FindVM: %v", err)
+	}
+	upgrade := false
+	want := CloudInit{
+		User:     "debian",
+		Password: "s3cret",
+		SSHKeys:  []string{"ssh-ed25519 AAAAC3Nza alice@example.com", "ssh-rsa AAAAB3Nza bob+ops@example.com"},
+		IPConfig: map[int]CloudInitIPConfig{
+			0: {IP: "192.0.2.10/24", Gateway: "192.0.2.1"},
+			1: {IP: "dhcp", IP6: "auto"},
+		},
+		Nameserver:   "192.0.2.53",
+		SearchDomain: "example.com",
+		Upgrade:      &upgrade,
+	}
+	if err = qemu.SetCloudInit(want); err != nil {
+		t.Fatalf("SetCloudInit: %v", err)
+	}
+	if fake, _ := srv.VM(100); fake.Config["ipconfig0"] != "ip=192.0.2.10/24,gw=192.0.2.1" {
+		t.Errorf("ipconfig0 = %q", fake.Config["ipconfig0"])
+	}
+
+	got, err := qemu.CloudInit()
+	if err != nil {
+		t.Fatalf("CloudInit: %v", err)
+	}
+	if got.User != want.User || got.Nameserver != want.Nameserver || got.SearchDomain != want.SearchDomain {
+		t.Errorf("CloudInit() = %+v, want %+v", got, want)
+	}
+	if got.Password == "" || got.Password == want.Password {
+		t.Errorf("Password = %q, want a placeholder", got.Password)
+	}
+	if len(got.SSHKeys) != 2 || got.SSHKeys[0] != want.SSHKeys[0] || got.SSHKeys[1] != want.SSHKeys[1] {
+		t.Errorf("SSHKeys = %q, want %q", got.SSHKeys, want.SSHKeys)
+	}
+	if len(got.IPConfig) != 2 || got.IPConfig[0] != want.IPConfig[0] || got.IPConfig[1] != want.IPConfig[1] {
+		t.Errorf("IPConfig = %+v, want %+v", got.IPConfig, want.IPConfig)
+	}
+	if got.Upgrade == nil || *got.Upgrade {
+		t.Errorf("Upgrade = %v, want false", got.Upgrade)
+	}
+
+	if err = qemu.SetCloudInit(CloudInit{}); err == nil {
+		t.Error("SetCloudInit without settings: got no error")
+	}
+	if err = qemu.SetCloudInit(CloudInit{IPConfig: map[int]CloudInitIPConfig{2: {}}}); err == nil {
+		t.Error("SetCloudInit with an empty IPConfig only: got no error")
+	}
+}
+
+func TestCloudInitChanges(t *testing.T) {
+	ci := CloudInit{
+		User: "debian",
+		IPConfig: map[int]CloudInitIPConfig{
+			0: {IP: "dhcp"},
+			1: {},
+		},
+	}
+	changes := ci.changes()
+	if len(changes) != 2 || changes["ciuser"] != "debian" || changes["ipconfig0"] != "ip=dhcp" {
+		t.Errorf("changes() = %q, want ciuser and ipconfig0 only", changes)
+	}
+	if _, ok := changes["ipconfig1"]; ok {
+		t.Error("changes() sets ipconfig1 for an empty entry")
+	}
+}
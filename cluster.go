@@ -0,0 +1,77 @@
+package proxmox
+
+import (
+	"context"
+)
+
+// ClusterStatus is the state of the cluster as reported by cluster/status.
+// A standalone node has no cluster name and is always quorate. Version is the
+// version of the cluster configuration.
+type ClusterStatus struct {
+	Name    string
+	Quorate bool
+	Version float64
+	Nodes   ClusterNodeList
+}
+
+type ClusterNode struct {
+	Name   string
+	Id     string
+	NodeId float64
+	Online bool
+	IP     string
+	Local  bool
+	Level  string
+}
+
+type ClusterNodeList map[string]ClusterNode
+
+type clusterStatusData struct {
+	Id         flexString `json:"id"`
+	StatusType flexString `json:"type"`
+	Name       flexString `json:"name"`
+	Quorate    flexFloat  `json:"quorate"`
+	Version    flexFloat  `json:"version"`
+	NodeId     flexFloat  `json:"nodeid"`
+	Online     flexFloat  `json:"online"`
+	IP         flexString `json:"ip"`
+	Local      flexFloat  `json:"local"`
+	Level      flexString `json:"level"`
+}
+
+func (proxmox ProxMox) ClusterStatus() (ClusterStatus, error) {
+	return proxmox.ClusterStatusCtx(context.Background())
+}
+
+func (proxmox ProxMox) ClusterStatusCtx(ctx context.Context) (ClusterStatus, error) {
+	var err error
+	var results []clusterStatusData
+	var status ClusterStatus
+
+	err = proxmox.Do(ctx, "GET", "cluster/status", nil, &results)
+	if err != nil {
+		return status, err
+	}
+
+	status.Quorate = true
+	status.Nodes = make(ClusterNodeList)
+	for _, v := range results {
+		switch string(v.StatusType) {
+		case "cluster":
+			status.Name = string(v.Name)
+			status.Quorate = v.Quorate != 0
+			status.Version = float64(v.Version)
+		case "node":
+			status.Nodes[string(v.Name)] = ClusterNode{
+				Name:   string(v.Name),
+				Id:     string(v.Id),
+				NodeId: float64(v.NodeId),
+				Online: v.Online != 0,
+				IP:     string(v.IP),
+				Local:  v.Local != 0,
+				Level:  string(v.Level),
+			}
+		}
+	}
+	return status, nil
+}
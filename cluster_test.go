@@ -0,0 +1,77 @@
+package proxmox
+
+import (
+	"testing"
+
+	"github.com/joernott/go-proxmox/proxmoxtest"
+)
+
+func TestClusterStatus(t *testing.T) {
+	srv := newTestServer(t)
+	proxmox := newTestClient(t, srv)
+
+	// A standalone node has no cluster entry.
+	status, err := proxmox.ClusterStatus()
+	if err != nil {
+		t.Fatalf("ClusterStatus: %v", err)
+	}
+	if status.Name != "" || !status.Quorate || len(status.Nodes) != 1 {
+		t.Errorf("ClusterStatus of a standalone node = %+v", status)
+	}
+
+	srv.AddNode("pve2")
+	srv.AddNode("pve3")
+	srv.SetNodeOnline("pve3", false)
+	status, err = proxmox.ClusterStatus()
+	if err != nil {
+		t.Fatalf("ClusterStatus: %v", err)
+	}
+	if status.Name != "pve-cluster" || !status.Quorate || status.Version != 3 {
+		t.Errorf("ClusterStatus = %q, quorate %v, version %v", status.Name, status.Quorate, status.Version)
+	}
+	want := ClusterNode{Name: "pve", Id: "node/pve", NodeId: 1, Online: true, IP: "127.0.0.1", Local: true}
+	if status.Nodes[proxmoxtest.DefaultNode] != want {
+		t.Errorf("node %s = %+v, want %+v", proxmoxtest.DefaultNode, status.Nodes[proxmoxtest.DefaultNode], want)
+	}
+	if pve3 := status.Nodes["pve3"]; pve3.Online || pve3.Local || pve3.NodeId != 3 {
+		t.Errorf("node pve3 = %+v, want offline", pve3)
+	}
+
+	srv.SetNodeOnline("pve2", false)
+	status, err = proxmox.ClusterStatus()
+	if err != nil {
+		t.Fatalf("ClusterStatus: %v", err)
+	}
+	if status.Quorate {
+		t.Error("Quorate = true with two of three nodes offline")
+	}
+}
+
+func TestAllNodes(t *testing.T) {
+	srv := newTestServer(t)
+	srv.AddNode("pve2")
+	srv.SetNodeOnline("pve2", false)
+	proxmox := newTestClient(t, srv)
+
+	nodes, err := proxmox.Nodes()
+	if err != nil {
+		t.Fatalf("Nodes: %v", err)
+	}
+	if _, ok := nodes["pve2"]; ok || len(nodes) != 1 {
+		t.Errorf("Nodes() = %v, want only %s", nodes, proxmoxtest.DefaultNode)
+	}
+
+	nodes, err = proxmox.AllNodes()
+	if err != nil {
+		t.Fatalf("AllNodes: %v", err)
+	}
+	if len(nodes) != 2 {
+		t.Fatalf("AllNodes() = %v, want two nodes", nodes)
+	}
+	if nodes[proxmoxtest.DefaultNode].Status != "online" {
+		t.Errorf("status of %s = %q, want online", proxmoxtest.DefaultNode, nodes[proxmoxtest.DefaultNode].Status)
+	}
+	if pve2 := nodes["pve2"]; pve2.Status != "offline" || pve2.MaxMem != 0 || pve2.Uptime != 0 {
+		t.Errorf("pve2 = status %q, maxmem %v, uptime %v, want offline without usage", pve2.Status, pve2.MaxMem, pve2.Uptime)
+	}
+}
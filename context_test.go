@@ -0,0 +1,57 @@
+package proxmox
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/joernott/go-proxmox/proxmoxtest"
+)
+
+func TestWaitForStatusCancelled(t *testing.T) {
+	srv := newTestServer(t)
+	srv.AddVM(proxmoxtest.VM{VMID: 100, Status: "stopped"})
+	proxmox := newTestClient(t, srv)
+	qemu, err := proxmox.FindVM("100")
+	if err != nil {
+		t.Fatalf("FindVM: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*200)
+	defer cancel()
+
+	start := time.Now()
+	err = qemu.WaitForStatusCtx(ctx, "running", 60)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("WaitForStatusCtx: got %v, want %v", err, context.DeadlineExceeded)
+	}
+	if time.Since(start) > time.Second*2 {
+		t.Errorf("WaitForStatusCtx returned after %v, want right after the deadline", time.Since(start))
+	}
+}
+
+func TestRequestCancelled(t *testing.T) {
+	s := newStubServer(t)
+	release := make(chan struct{})
+	defer close(release)
+	s.handle("GET nodes/pve/qemu", func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-release:
+		}
+	})
+	proxmox := newStubClient(t, s)
+	node := Node{Node: "pve", Proxmox: proxmox}
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(time.Millisecond*100, cancel)
+
+	start := time.Now()
+	_, err := node.QemuCtx(ctx)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("QemuCtx: got %v, want %v", err, context.Canceled)
+	}
+	if time.Since(start) > time.Second*2 {
+		t.Errorf("QemuCtx returned after %v, want right after the cancellation", time.Since(start))
+	}
+}
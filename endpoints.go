@@ -0,0 +1,193 @@
+package proxmox
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// endpointProbeTimeout limits how long a health check of a single node takes.
+const endpointProbeTimeout = time.Second * 5
+
+// endpoints holds the addresses of all cluster nodes the client may talk to
+// and which of them is currently in use. It is shared by all copies of a
+// ProxMox value.
+type endpoints struct {
+	switching sync.Mutex
+	mu        sync.RWMutex
+	hosts     []string
+	current   int
+}
+
+// WithFailover adds further cluster nodes. When the current node cannot be
+// reached, the client switches to the next reachable one and logs in there.
+func WithFailover(HostNames ...string) Option {
+	return func(o *options) error {
+		o.failover = append(o.failover, HostNames...)
+		return nil
+	}
+}
+
+func normalizeHost(HostName string, port int) (string, error) {
+	if !strings.HasPrefix(HostName, "http://") && !strings.HasPrefix(HostName, "https://") {
+		HostName = "https://" + HostName
+	}
+	hostURL, err := url.Parse(strings.TrimRight(HostName, "/"))
+	if err != nil {
+		return "", err
+	}
+	if hostURL.Port() == "" {
+		hostURL.Host = hostURL.Host + ":" + strconv.Itoa(port)
+	}
+	return hostURL.String(), nil
+}
+
+func (e *endpoints) get() string {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.hosts[e.current]
+}
+
+// hostname returns the node currently in use.
+func (proxmox ProxMox) hostname() string {
+	if proxmox.endpoints == nil {
+		return proxmox.Hostname
+	}
+	return proxmox.endpoints.get()
+}
+
+func (proxmox ProxMox) baseURL() string {
+	if proxmox.endpoints == nil {
+		return proxmox.BaseURL
+	}
+	return proxmox.endpoints.get() + "/api2/json/"
+}
+
+// Endpoints returns the addresses of all configured nodes, the one currently
+// in use first.
+func (proxmox ProxMox) Endpoints() []string {
+	var result []string
+
+	if proxmox.endpoints == nil {
+		return []string{proxmox.Hostname}
+	}
+	proxmox.endpoints.mu.RLock()
+	defer proxmox.endpoints.mu.RUnlock()
+	for i := range proxmox.endpoints.hosts {
+		result = append(result, proxmox.endpoints.hosts[(proxmox.endpoints.current+i)%len(proxmox.endpoints.hosts)])
+	}
+	return result
+}
+
+func (proxmox ProxMox) CheckEndpoints() map[string]error {
+	return proxmox.CheckEndpointsCtx(context.Background())
+}
+
+// CheckEndpointsCtx checks whether the API of every configured node can be
+// reached. The result maps each address to nil or the error encountered.
+func (proxmox ProxMox) CheckEndpointsCtx(ctx context.Context) map[string]error {
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+
+	result := make(map[string]error)
+	for _, host := range proxmox.Endpoints() {
+		wg.Add(1)
+		go func(host string) {
+			defer wg.Done()
+			err := proxmox.probe(ctx, host)
+			mu.Lock()
+			result[host] = err
+			mu.Unlock()
+		}(host)
+	}
+	wg.Wait()
+	return result
+}
+
+// probe checks whether the API on host answers at all. An authentication
+// error is fine, it proves that pveproxy is running.
+func (proxmox ProxMox) probe(ctx context.Context, host string) error {
+	ctx, cancel := context.WithTimeout(ctx, endpointProbeTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", host+"/api2/json/version", nil)
+	if err != nil {
+		return err
+	}
+	r, err := proxmox.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	r.Body.Close()
+	if r.StatusCode >= 500 {
+		return errors.New("HTTP Error " + r.Status)
+	}
+	return nil
+}
+
+// failover switches to the next reachable node after a request to failed
+// could not be sent and logs in there. It returns false if there is no other
+// node to switch to.
+func (proxmox ProxMox) failover(ctx context.Context, failed string) bool {
+	var err error
+
+	if proxmox.endpoints == nil || len(proxmox.endpoints.hosts) < 2 {
+		return false
+	}
+	proxmox.endpoints.switching.Lock()
+	defer proxmox.endpoints.switching.Unlock()
+
+	if proxmox.endpoints.get() != failed {
+		// Another request already switched.
+		return true
+	}
+	for _, host := range proxmox.Endpoints()[1:] {
+		if ctx.Err() != nil {
+			return false
+		}
+		err = proxmox.probe(ctx, host)
+		if err != nil {
+			proxmox.log().DebugContext(ctx, "Node not reachable", "host", host, "error", err)
+			continue
+		}
+		proxmox.endpoints.mu.Lock()
+		for i, h := range proxmox.endpoints.hosts {
+			if h == host {
+				proxmox.endpoints.current = i
+			}
+		}
+		proxmox.endpoints.mu.Unlock()
+		proxmox.log().WarnContext(ctx, "Switched to another node", "from", failed, "to", host)
+
+		if proxmox.session != nil && proxmox.apiToken == "" {
+			err = proxmox.login(ctx, proxmox.password)
+			if err != nil {
+				proxmox.log().DebugContext(ctx, "Login failed", "host", host, "error", err)
+				continue
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// canFailover tells whether a request that failed with err may be sent again
+// to another node. Requests that could not even connect never reached the
+// server, everything else is only repeated for GET.
+func canFailover(method string, err error) bool {
+	var opErr *net.OpError
+
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return true
+	}
+	return method == "GET"
+}
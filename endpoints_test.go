@@ -0,0 +1,85 @@
+package proxmox
+
+import (
+	"testing"
+)
+
+func TestNormalizeHost(t *testing.T) {
+	tests := []struct {
+		host string
+		want string
+	}{
+		{host: "pve1", want: "https://pve1:8006"},
+		{host: "pve1:443", want: "https://pve1:443"},
+		{host: "https://pve1/", want: "https://pve1:8006"},
+		{host: "http://pve1:8080", want: "http://pve1:8080"},
+	}
+	for _, tt := range tests {
+		got, err := normalizeHost(tt.host, DefaultPort)
+		if err != nil {
+			t.Errorf("normalizeHost(%q): %v", tt.host, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("normalizeHost(%q) = %q, want %q", tt.host, got, tt.want)
+		}
+	}
+}
+
+func TestFailover(t *testing.T) {
+	first := newStubServer(t)
+	second := newStubServer(t)
+	second.handleData("GET nodes/pve/qemu", `[{"vmid":100,"name":"web","status":"running","uptime":60,"cpu":0.1,"cpus":2,
+		"mem":536870912,"maxmem":1073741824,"disk":0,"maxdisk":10737418240,"netin":0,"netout":0,"diskread":0,"diskwrite":0}]`)
+
+	proxmox, err := New(first.URL, WithPassword(stubUser, stubPassword), WithFailover(second.URL))
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if got := proxmox.Endpoints(); len(got) != 2 || got[0] != first.URL {
+		t.Fatalf("Endpoints() = %v, want %s first", got, first.URL)
+	}
+	for host, err := range proxmox.CheckEndpoints() {
+		if err != nil {
+			t.Errorf("CheckEndpoints: %s: %v", host, err)
+		}
+	}
+
+	// The second node does not know the ticket of the first one, so the
+	// client has to log in again after switching.
+	first.Close()
+	nodes, err := proxmox.Nodes()
+	if err != nil {
+		t.Fatalf("Nodes after the first node went down: %v", err)
+	}
+	qemuList, err := nodes["pve"].Qemu()
+	if err != nil {
+		t.Fatalf("Qemu after the first node went down: %v", err)
+	}
+	if _, ok := qemuList["100"]; !ok {
+		t.Errorf("Qemu() = %v, want the VM of the second server", qemuList)
+	}
+	if got := proxmox.Endpoints(); got[0] != second.URL {
+		t.Errorf("Endpoints() = %v, want %s first", got, second.URL)
+	}
+	if err = proxmox.CheckEndpoints()[first.URL]; err == nil {
+		t.Errorf("CheckEndpoints: got no error for %s", first.URL)
+	}
+}
+
+func TestFailoverOnLogin(t *testing.T) {
+	down := newStubServer(t)
+	down.Close()
+	up := newStubServer(t)
+
+	proxmox, err := New(down.URL, WithPassword(stubUser, stubPassword), WithFailover(up.URL))
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if got := proxmox.Endpoints(); got[0] != up.URL {
+		t.Errorf("Endpoints() = %v, want %s first", got, up.URL)
+	}
+	if _, err = proxmox.Nodes(); err != nil {
+		t.Errorf("Nodes: %v", err)
+	}
+}
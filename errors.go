@@ -0,0 +1,127 @@
+package proxmox
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrNotFound         = errors.New("Not found")
+	ErrUnauthorized     = errors.New("Unauthorized")
+	ErrPermissionDenied = errors.New("Permission denied")
+	ErrConfigModified   = errors.New("Configuration modified")
+)
+
+// APIError is returned when the API answers a request with a status other
+// than 200. Errors holds the per-parameter messages Proxmox sends when a
+// parameter fails validation, Body the unparsed response.
+type APIError struct {
+	StatusCode int
+	Method     string
+	Endpoint   string
+	Message    string
+	Errors     map[string]string
+	Body       []byte
+}
+
+type errorResult struct {
+	Message string                 `json:"message"`
+	Errors  map[string]interface{} `json:"errors"`
+}
+
+func (e *APIError) Error() string {
+	var keys []string
+	var msg string
+
+	msg = "HTTP Error " + strconv.Itoa(e.StatusCode)
+	if e.Message != "" {
+		msg = msg + " " + e.Message
+	}
+	msg = msg + " (" + e.Method + " " + e.Endpoint + ")"
+	for k := range e.Errors {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		msg = msg + ", " + k + ": " + e.Errors[k]
+	}
+	return msg
+}
+
+// Is makes APIError match ErrNotFound, ErrUnauthorized, ErrPermissionDenied
+// and ErrConfigModified with errors.Is.
+func (e *APIError) Is(target error) bool {
+	switch target {
+	case ErrNotFound:
+		if e.StatusCode == http.StatusNotFound {
+			return true
+		}
+		// Missing guests and storages are reported as internal errors.
+		return e.StatusCode == http.StatusInternalServerError &&
+			(strings.Contains(e.Message, "does not exist") || strings.Contains(e.Message, "no such"))
+	case ErrUnauthorized:
+		return e.StatusCode == http.StatusUnauthorized
+	case ErrPermissionDenied:
+		return e.StatusCode == http.StatusForbidden
+	case ErrConfigModified:
+		// The digest sent with a change does not match the configuration.
+		return strings.Contains(e.Message, "detected modified configuration")
+	}
+	return false
+}
+
+func IsNotFound(err error) bool {
+	return errors.Is(err, ErrNotFound)
+}
+
+func IsUnauthorized(err error) bool {
+	return errors.Is(err, ErrUnauthorized)
+}
+
+func IsPermissionDenied(err error) bool {
+	return errors.Is(err, ErrPermissionDenied)
+}
+
+func IsConfigModified(err error) bool {
+	return errors.Is(err, ErrConfigModified)
+}
+
+// newAPIError builds an APIError from a failed response and closes its body.
+// pveproxy puts the error message into the reason phrase of the status line.
+func newAPIError(method string, endpoint string, r *http.Response) *APIError {
+	var data errorResult
+
+	apiErr := &APIError{
+		StatusCode: r.StatusCode,
+		Method:     method,
+		Endpoint:   endpoint,
+		Message:    strings.TrimSpace(strings.TrimPrefix(r.Status, strconv.Itoa(r.StatusCode))),
+	}
+	response, err := ioutil.ReadAll(r.Body)
+	r.Body.Close()
+	apiErr.Body = response
+	if err != nil || json.Unmarshal(response, &data) != nil {
+		return apiErr
+	}
+	if data.Message != "" {
+		apiErr.Message = strings.TrimSpace(data.Message)
+	}
+	if len(data.Errors) > 0 {
+		apiErr.Errors = make(map[string]string)
+		for k, v := range data.Errors {
+			switch v.(type) {
+			case string:
+				apiErr.Errors[k] = strings.TrimSpace(v.(string))
+			default:
+				b, _ := json.Marshal(v)
+				apiErr.Errors[k] = string(b)
+			}
+		}
+	}
+	return apiErr
+}
@@ -0,0 +1,114 @@
+package proxmox
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestAPIErrorFromServer(t *testing.T) {
+	s := newStubServer(t)
+	s.handle("POST nodes/pve/qemu/100/migrate", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, `{"data":null,"errors":{"target":"no such cluster node 'nosuch'\n","online":{"nested":true}},"message":"Parameter verification failed.\n"}`)
+	})
+	s.handle("GET nodes/pve/qemu/999/config", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, `{"data":null,"message":"Configuration file 'nodes/pve/qemu-server/999.conf' does not exist\n"}`)
+	})
+	proxmox := newStubClient(t, s)
+
+	_, err := proxmox.PostForm("nodes/pve/qemu/100/migrate", url.Values{"target": {"nosuch"}})
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("PostForm: got %T %v, want *APIError", err, err)
+	}
+	if apiErr.StatusCode != http.StatusBadRequest || apiErr.Method != "POST" || apiErr.Endpoint != "nodes/pve/qemu/100/migrate" {
+		t.Errorf("APIError = %d %s %s", apiErr.StatusCode, apiErr.Method, apiErr.Endpoint)
+	}
+	if apiErr.Message != "Parameter verification failed." {
+		t.Errorf("Message = %q", apiErr.Message)
+	}
+	if apiErr.Errors["target"] != "no such cluster node 'nosuch'" || apiErr.Errors["online"] != `{"nested":true}` {
+		t.Errorf("Errors = %q", apiErr.Errors)
+	}
+	want := `HTTP Error 400 Parameter verification failed. (POST nodes/pve/qemu/100/migrate), online: {"nested":true}, target: no such cluster node 'nosuch'`
+	if err.Error() != want {
+		t.Errorf("Error() = %q, want %q", err.Error(), want)
+	}
+
+	_, err = proxmox.Get("nodes/pve/qemu/999/config")
+	if !IsNotFound(err) {
+		t.Errorf("Get of a missing VM: got %v, want an error matching ErrNotFound", err)
+	}
+	// Get and GetBytes no longer return the body of a failed request, it is
+	// kept in the APIError.
+	body := `{"data":null,"message":"Configuration file 'nodes/pve/qemu-server/999.conf' does not exist\n"}`
+	for name, get := range map[string]func(string) error{
+		"Get":      func(endpoint string) error { _, err := proxmox.Get(endpoint); return err },
+		"GetBytes": func(endpoint string) error { _, err := proxmox.GetBytes(endpoint); return err },
+	} {
+		err = get("nodes/pve/qemu/999/config")
+		if !errors.As(err, &apiErr) || string(apiErr.Body) != body {
+			t.Errorf("%s: got %v, want an APIError with body %s", name, err, body)
+		}
+	}
+
+	_, err = NewProxMox(s.URL, stubUser, "wrong")
+	if !IsUnauthorized(err) {
+		t.Errorf("NewProxMox with a wrong password: got %v, want an error matching ErrUnauthorized", err)
+	}
+}
+
+func TestAPIErrorIs(t *testing.T) {
+	tests := []struct {
+		name         string
+		code         int
+		status       string
+		body         string
+		wantMessage  string
+		notFound     bool
+		unauthorized bool
+		denied       bool
+		modified     bool
+	}{
+		{name: "not found", code: 404, status: "404 Not Found", wantMessage: "Not Found", notFound: true},
+		{name: "missing guest", code: 500, status: "500 Internal Server Error",
+			body:        `{"data":null,"message":"Configuration file 'nodes/pve/qemu-server/999.conf' does not exist\n"}`,
+			wantMessage: "Configuration file 'nodes/pve/qemu-server/999.conf' does not exist", notFound: true},
+		{name: "reason phrase", code: 401, status: "401 authentication failure", wantMessage: "authentication failure", unauthorized: true},
+		{name: "permission", code: 403, status: "403 Permission check failed (/vms/100, VM.Config.Memory)",
+			wantMessage: "Permission check failed (/vms/100, VM.Config.Memory)", denied: true},
+		{name: "digest", code: 500, status: "500 Internal Server Error",
+			body:        `{"data":null,"message":"detected modified configuration - file changed by other user? Try again.\n"}`,
+			wantMessage: "detected modified configuration - file changed by other user? Try again.", modified: true},
+		{name: "other", code: 500, status: "500 got timeout", wantMessage: "got timeout"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &http.Response{StatusCode: tt.code, Status: tt.status, Body: io.NopCloser(strings.NewReader(tt.body))}
+			var err error = newAPIError("GET", "nodes", r)
+
+			if err.(*APIError).Message != tt.wantMessage {
+				t.Errorf("Message = %q, want %q", err.(*APIError).Message, tt.wantMessage)
+			}
+			if IsNotFound(err) != tt.notFound {
+				t.Errorf("IsNotFound = %v, want %v", IsNotFound(err), tt.notFound)
+			}
+			if IsUnauthorized(err) != tt.unauthorized {
+				t.Errorf("IsUnauthorized = %v, want %v", IsUnauthorized(err), tt.unauthorized)
+			}
+			if IsPermissionDenied(err) != tt.denied {
+				t.Errorf("IsPermissionDenied = %v, want %v", IsPermissionDenied(err), tt.denied)
+			}
+			if IsConfigModified(err) != tt.modified {
+				t.Errorf("IsConfigModified = %v, want %v", IsConfigModified(err), tt.modified)
+			}
+		})
+	}
+}
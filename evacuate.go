@@ -0,0 +1,193 @@
+package proxmox
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// EvacuateOptions control Node.Evacuate. Parallel is the number of
+// migrations running at the same time, at least 1. Targets restricts the
+// nodes the VMs may be moved to, by default all other online nodes are used.
+// Timeout is the number of seconds to wait for each migration, 600 if not set.
+type EvacuateOptions struct {
+	Parallel       int
+	Targets        []string
+	WithLocalDisks bool
+	BWLimit        int
+	OverCommitCPU  float64
+	OverCommitMem  float64
+	Timeout        int
+}
+
+// EvacuatedVM is the outcome for one VM. Reason tells why a VM was skipped,
+// Error why it failed.
+type EvacuatedVM struct {
+	VMId   string
+	Name   string
+	Target string
+	Task   Task
+	Reason string
+	Error  error
+}
+
+type EvacuationReport struct {
+	Moved   []EvacuatedVM
+	Skipped []EvacuatedVM
+	Failed  []EvacuatedVM
+}
+
+func (node Node) Evacuate(opts EvacuateOptions) (EvacuationReport, error) {
+	return node.EvacuateCtx(context.Background(), opts)
+}
+
+// EvacuateCtx migrates all running VMs to other nodes. The VMs are placed
+// largest first on the node with the most free memory, unlike
+// DetermineVMPlacement, which takes any node that fits. Stopped VMs and
+// templates are skipped. An error is only returned if the evacuation could
+// not be started, failed migrations are listed in the report.
+func (node Node) EvacuateCtx(ctx context.Context, opts EvacuateOptions) (EvacuationReport, error) {
+	var report EvacuationReport
+	var err error
+	var qemuList QemuList
+	var vms []QemuVM
+	var usages map[string]*nodeUsage
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var slots chan struct{}
+
+	if opts.Parallel < 1 {
+		opts.Parallel = 1
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = 600
+	}
+
+	qemuList, err = node.QemuCtx(ctx)
+	if err != nil {
+		return report, err
+	}
+	usages, err = nodeUsages(ctx, node.Proxmox, node.Node)
+	if err != nil {
+		return report, err
+	}
+	if len(opts.Targets) > 0 {
+		allowed := make(map[string]bool)
+		for _, target := range opts.Targets {
+			allowed[target] = true
+		}
+		for name := range usages {
+			if !allowed[name] {
+				delete(usages, name)
+			}
+		}
+	}
+	if len(usages) == 0 {
+		return report, errors.New("No node to evacuate " + node.Node + " to.")
+	}
+
+	for _, qemu := range qemuList {
+		vms = append(vms, qemu)
+	}
+	sort.Slice(vms, func(i, j int) bool {
+		if vms[i].MaxMem != vms[j].MaxMem {
+			return vms[i].MaxMem > vms[j].MaxMem
+		}
+		return vms[i].VMId < vms[j].VMId
+	})
+
+	slots = make(chan struct{}, opts.Parallel)
+	for _, qemu := range vms {
+		result := EvacuatedVM{
+			VMId: strconv.FormatFloat(qemu.VMId, 'f', 0, 64),
+			Name: qemu.Name,
+		}
+		if qemu.Template != 0 {
+			result.Reason = "template"
+			report.Skipped = append(report.Skipped, result)
+			continue
+		}
+		if qemu.Status != "running" {
+			result.Reason = "not running"
+			report.Skipped = append(report.Skipped, result)
+			continue
+		}
+		// Reserve the capacity on the target before the next VM is placed.
+		target := place(usages, int64(qemu.CPUs), int64(qemu.MaxMem), opts.OverCommitCPU, opts.OverCommitMem)
+		if target == nil {
+			result.Error = errors.New("Not enough free capacity on any of the nodes.")
+			mu.Lock()
+			report.Failed = append(report.Failed, result)
+			mu.Unlock()
+			continue
+		}
+		target.usedCPUs = target.usedCPUs + int64(qemu.CPUs)
+		target.usedMem = target.usedMem + int64(qemu.MaxMem)
+		result.Target = target.node.Node
+
+		wg.Add(1)
+		go func(qemu QemuVM, result EvacuatedVM) {
+			defer wg.Done()
+			select {
+			case slots <- struct{}{}:
+			case <-ctx.Done():
+				result.Error = ctx.Err()
+				mu.Lock()
+				report.Failed = append(report.Failed, result)
+				mu.Unlock()
+				return
+			}
+			result.Task, result.Error = node.migrate(ctx, qemu, result.Target, opts)
+			<-slots
+			logger(node.Proxmox).InfoContext(ctx, "Evacuated VM", "node", node.Node, "vmid", result.VMId,
+				"target", result.Target, "error", result.Error)
+			mu.Lock()
+			if result.Error != nil {
+				report.Failed = append(report.Failed, result)
+			} else {
+				report.Moved = append(report.Moved, result)
+			}
+			mu.Unlock()
+		}(qemu, result)
+	}
+	wg.Wait()
+	sortEvacuated(report.Skipped)
+	sortEvacuated(report.Moved)
+	sortEvacuated(report.Failed)
+	return report, nil
+}
+
+func sortEvacuated(vms []EvacuatedVM) {
+	sort.Slice(vms, func(i, j int) bool {
+		if len(vms[i].VMId) != len(vms[j].VMId) {
+			return len(vms[i].VMId) < len(vms[j].VMId)
+		}
+		return vms[i].VMId < vms[j].VMId
+	})
+}
+
+// migrate moves a VM online and waits for the migration to finish.
+func (node Node) migrate(ctx context.Context, qemu QemuVM, target string, opts EvacuateOptions) (Task, error) {
+	var task Task
+	var exitStatus string
+	var err error
+
+	task, err = qemu.MigrateCtx(ctx, target, MigrateOptions{
+		Online:         true,
+		WithLocalDisks: opts.WithLocalDisks,
+		BWLimit:        opts.BWLimit,
+	})
+	if err != nil {
+		return task, err
+	}
+	exitStatus, err = task.WaitForStatusCtx(ctx, "stopped", opts.Timeout)
+	if err != nil {
+		return task, err
+	}
+	if exitStatus != "OK" {
+		return task, errors.New("Migration of VM " + task.ID + " failed: " + exitStatus)
+	}
+	return task, nil
+}
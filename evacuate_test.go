@@ -0,0 +1,145 @@
+package proxmox
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/joernott/go-proxmox/proxmoxtest"
+)
+
+func evacuatedIDs(vms []EvacuatedVM) []string {
+	var ids []string
+
+	for _, vm := range vms {
+		ids = append(ids, vm.VMId)
+	}
+	return ids
+}
+
+func equalIDs(got []string, want ...string) bool {
+	if len(got) != len(want) {
+		return false
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// TestEvacuateNoCapacity has VMs fail placement while earlier migrations are
+// still running or failing, run it with -race.
+func TestEvacuateNoCapacity(t *testing.T) {
+	srv := newTestServer(t)
+	srv.TaskDuration = time.Millisecond * 500
+	srv.AddNode("pve2").MaxMem = 10 << 30
+	// A passed through device blocks the migration of 101.
+	srv.AddVM(proxmoxtest.VM{VMID: 101, Status: "running", Config: map[string]string{"memory": "4096", "hostpci0": "0000:01:00"}})
+	for _, vmid := range []int{102, 103, 104} {
+		srv.AddVM(proxmoxtest.VM{VMID: vmid, Status: "running", Config: map[string]string{"memory": "4096"}})
+	}
+	srv.AddVM(proxmoxtest.VM{VMID: 105, Status: "stopped"})
+	srv.AddVM(proxmoxtest.VM{VMID: 106, Status: "running", Template: true})
+	proxmox := newTestClient(t, srv)
+	nodes, err := proxmox.Nodes()
+	if err != nil {
+		t.Fatalf("Nodes: %v", err)
+	}
+
+	report, err := nodes[proxmoxtest.DefaultNode].Evacuate(EvacuateOptions{Parallel: 2, Timeout: 10})
+	if err != nil {
+		t.Fatalf("Evacuate: %v", err)
+	}
+	// pve2 only has room for two of the 4 GiB VMs, 101 and 102.
+	if got := evacuatedIDs(report.Moved); !equalIDs(got, "102") {
+		t.Errorf("Moved = %v, want [102]", got)
+	}
+	if got := evacuatedIDs(report.Failed); !equalIDs(got, "101", "103", "104") {
+		t.Errorf("Failed = %v, want [101 103 104]", got)
+	}
+	if got := evacuatedIDs(report.Skipped); !equalIDs(got, "105", "106") {
+		t.Errorf("Skipped = %v, want [105 106]", got)
+	}
+	for _, vm := range report.Moved {
+		if vm.Target != "pve2" || vm.Task.UPid == "" || vm.Error != nil {
+			t.Errorf("moved VM %s: target %q, task %q, error %v", vm.VMId, vm.Target, vm.Task.UPid, vm.Error)
+		}
+		vmid, _ := strconv.Atoi(vm.VMId)
+		if fake, _ := srv.VM(vmid); fake.Node != "pve2" {
+			t.Errorf("VM %s is on %s, want pve2", vm.VMId, fake.Node)
+		}
+	}
+	for _, vm := range report.Failed {
+		if vm.Error == nil || (vm.Target != "") != (vm.VMId == "101") {
+			t.Errorf("failed VM %s: target %q, error %v", vm.VMId, vm.Target, vm.Error)
+		}
+	}
+}
+
+func TestEvacuateFailedMigration(t *testing.T) {
+	srv := newTestServer(t)
+	srv.TaskDuration = time.Millisecond * 1500
+	srv.AddNode("pve2")
+	srv.AddVM(proxmoxtest.VM{VMID: 101, Status: "running"})
+	proxmox := newTestClient(t, srv)
+	nodes, err := proxmox.Nodes()
+	if err != nil {
+		t.Fatalf("Nodes: %v", err)
+	}
+
+	done := make(chan EvacuationReport)
+	go func() {
+		report, err := nodes[proxmoxtest.DefaultNode].Evacuate(EvacuateOptions{Timeout: 10})
+		if err != nil {
+			t.Errorf("Evacuate: %v", err)
+		}
+		done <- report
+	}()
+	// Fail the migration while it is running.
+	deadline := time.Now().Add(time.Second * 5)
+	for failed := false; !failed && time.Now().Before(deadline); {
+		for _, task := range srv.Tasks() {
+			if task.Type == "qmigrate" {
+				srv.FailTask(task.UPID, "migration problems")
+				failed = true
+			}
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+	report := <-done
+
+	if len(report.Moved) != 0 || len(report.Failed) != 1 {
+		t.Fatalf("Moved = %v, Failed = %v, want 101 failed", evacuatedIDs(report.Moved), evacuatedIDs(report.Failed))
+	}
+	failed := report.Failed[0]
+	if failed.VMId != "101" || failed.Target != "pve2" || failed.Task.UPid == "" {
+		t.Errorf("failed VM %s: target %q, task %q", failed.VMId, failed.Target, failed.Task.UPid)
+	}
+	if failed.Error == nil || failed.Error.Error() != "Migration of VM 101 failed: migration problems" {
+		t.Errorf("Error = %v", failed.Error)
+	}
+}
+
+func TestEvacuateWithoutTarget(t *testing.T) {
+	srv := newTestServer(t)
+	srv.AddNode("pve2")
+	srv.AddVM(proxmoxtest.VM{VMID: 101, Status: "running"})
+	proxmox := newTestClient(t, srv)
+	nodes, err := proxmox.Nodes()
+	if err != nil {
+		t.Fatalf("Nodes: %v", err)
+	}
+
+	_, err = nodes[proxmoxtest.DefaultNode].Evacuate(EvacuateOptions{Targets: []string{"pve3"}})
+	if err == nil {
+		t.Error("Evacuate to an unknown node: got no error")
+	}
+
+	srv.SetNodeOnline("pve2", false)
+	_, err = nodes[proxmoxtest.DefaultNode].Evacuate(EvacuateOptions{})
+	if err == nil {
+		t.Error("Evacuate without online target: got no error")
+	}
+}
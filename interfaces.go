@@ -0,0 +1,108 @@
+package proxmox
+
+import (
+	"context"
+	"io"
+	"net/url"
+)
+
+// Requester sends a request to the API and decodes the data member of the
+// response into out, see ProxMox.Do. Node, QemuVM, Storage and Task make all
+// their requests through the Requester they were created with, so a fake or
+// a decorator, e.g. for caching or auditing, can take the place of ProxMox:
+//
+//	node := proxmox.Node{Node: "pve", Proxmox: fake}
+//
+// Requester is the seam for mocking the whole API. The interfaces below only
+// list the Ctx variants of the methods, the others call them with
+// context.Background().
+type Requester interface {
+	Do(ctx context.Context, method string, endpoint string, params url.Values, out interface{}) error
+}
+
+// Client is the part of ProxMox services usually need. The nodes and VMs it
+// returns use the Client's Requester.
+type Client interface {
+	Requester
+	NodesCtx(ctx context.Context) (NodeList, error)
+	ResourcesCtx(ctx context.Context, kind string) (Resources, error)
+	FindVMCtx(ctx context.Context, VmId string) (QemuVM, error)
+	NextVMIdCtx(ctx context.Context) (string, error)
+	ClusterStatusCtx(ctx context.Context) (ClusterStatus, error)
+	AllNodesCtx(ctx context.Context) (NodeList, error)
+	DetermineVMPlacementCtx(ctx context.Context, cpu int64, cores int64, mem int64, overCommitCPU float64, overCommitMem float64) (Node, error)
+}
+
+// NodeAPI lists, creates, backs up and evacuates the VMs of a node.
+type NodeAPI interface {
+	QemuCtx(ctx context.Context) (QemuList, error)
+	StoragesCtx(ctx context.Context) (StorageList, error)
+	TasksCtx(ctx context.Context, Limit int, Start int, UserFilter string, VmId string) (TaskList, error)
+	NewVM() *VMBuilder
+	CreateQemuVMCtx(ctx context.Context, Name string, Sockets int, Cores int, MemorySize int, DiskSize string) (string, error)
+	VZDumpCtx(ctx context.Context, VmId string, BWLimit int, Compress string, IONice int, LockWait int, Mode string) (string, error)
+	EvacuateCtx(ctx context.Context, opts EvacuateOptions) (EvacuationReport, error)
+}
+
+// VMAPI controls the power state, the configuration, cloud-init, clones and
+// migrations of a VM.
+type VMAPI interface {
+	CurrentStatusCtx(ctx context.Context) (QemuStatus, error)
+	WaitForStatusCtx(ctx context.Context, status string, timeout int) error
+	StartCtx(ctx context.Context) error
+	ShutdownCtx(ctx context.Context) (Task, error)
+	StopCtx(ctx context.Context) (string, error)
+	SuspendCtx(ctx context.Context) error
+	ResumeCtx(ctx context.Context) error
+	ConfigCtx(ctx context.Context) (QemuConfig, error)
+	UpdateConfigCtx(ctx context.Context, changes map[string]string, deletes []string, digest string) error
+	UpdateConfigAsyncCtx(ctx context.Context, changes map[string]string, deletes []string, digest string) (Task, error)
+	CloudInitCtx(ctx context.Context) (CloudInit, error)
+	SetCloudInitCtx(ctx context.Context, ci CloudInit) error
+	RegenerateCloudInitCtx(ctx context.Context) error
+	CloneCtx(ctx context.Context, newId float64, name string, targetName string) (Task, error)
+	CloneToPoolCtx(ctx context.Context, newId float64, name string, targetName string, pool string) (Task, error)
+	MigrateCheckCtx(ctx context.Context, target string) (MigrationCheck, error)
+	MigrateCtx(ctx context.Context, target string, opts MigrateOptions) (Task, error)
+	DeleteCtx(ctx context.Context) (map[string]interface{}, error)
+}
+
+// SnapshotAPI manages the snapshots of a VM.
+type SnapshotAPI interface {
+	SnapshotsCtx(ctx context.Context) (SnapshotTree, error)
+	SnapshotCtx(ctx context.Context, name string, includeRAM bool) (Task, error)
+	SnapshotConfigCtx(ctx context.Context, name string) (QemuConfig, error)
+	UpdateSnapshotCtx(ctx context.Context, name string, description string) error
+	DeleteSnapshotCtx(ctx context.Context, name string, force bool) (Task, error)
+	RollbackCtx(ctx context.Context, name string) (Task, error)
+}
+
+// GuestAgentAPI runs commands and transfers files through the guest agent.
+type GuestAgentAPI interface {
+	PingCtx(ctx context.Context) error
+	RunCtx(ctx context.Context, command []string, input string, timeout int) (AgentExecStatus, error)
+	FileReadCtx(ctx context.Context, file string) (string, bool, error)
+	FileWriteCtx(ctx context.Context, file string, content string) error
+}
+
+// StorageAPI creates and lists the volumes of a storage.
+type StorageAPI interface {
+	CreateVolumeCtx(ctx context.Context, FileName string, DiskSize string, VmId string) (map[string]interface{}, error)
+	VolumesCtx(ctx context.Context) (VolumeList, error)
+}
+
+// TaskAPI waits for a task and reads its log.
+type TaskAPI interface {
+	WaitForStatusCtx(ctx context.Context, status string, timeout int) (string, error)
+	Follow(ctx context.Context, w io.Writer) error
+}
+
+var (
+	_ Client        = ProxMox{}
+	_ NodeAPI       = Node{}
+	_ VMAPI         = QemuVM{}
+	_ SnapshotAPI   = QemuVM{}
+	_ GuestAgentAPI = GuestAgent{}
+	_ StorageAPI    = Storage{}
+	_ TaskAPI       = Task{}
+)
@@ -0,0 +1,111 @@
+package proxmox
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+	"testing"
+
+	"github.com/joernott/go-proxmox/proxmoxtest"
+)
+
+// fakeRequester answers requests with canned data members keyed by method
+// and endpoint and records the requests it got.
+type fakeRequester struct {
+	responses map[string]string
+	requests  []string
+}
+
+func (f *fakeRequester) Do(ctx context.Context, method string, endpoint string, params url.Values, out interface{}) error {
+	f.requests = append(f.requests, method+" "+endpoint)
+	data, ok := f.responses[method+" "+endpoint]
+	if !ok {
+		return &APIError{StatusCode: 404, Method: method, Endpoint: endpoint, Message: "no such endpoint"}
+	}
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal([]byte(data), out)
+}
+
+func TestNodeWithFakeRequester(t *testing.T) {
+	fake := &fakeRequester{responses: map[string]string{
+		"GET nodes/pve/qemu":                                                 `[{"vmid":100,"name":"web","status":"stopped","maxmem":"2147483648"}]`,
+		"POST nodes/pve/qemu/100/status/start":                               `"UPID:pve:1:2:3:qmstart:100:root@pam:"`,
+		"POST nodes/pve/qemu/100/status/shutdown":                            `"UPID:pve:4:5:6:qmshutdown:100:root@pam:"`,
+		"GET nodes/pve/tasks/UPID:pve:4:5:6:qmshutdown:100:root@pam:/status": `{"status":"stopped","exitstatus":"OK"}`,
+	}}
+	node := Node{Node: "pve", Proxmox: fake}
+
+	list, err := node.Qemu()
+	if err != nil {
+		t.Fatalf("Qemu: %v", err)
+	}
+	qemu, ok := list["100"]
+	if !ok || qemu.Name != "web" || qemu.MaxMem != 2147483648 {
+		t.Fatalf("Qemu() = %+v, want VM 100 named web", list)
+	}
+	if err = qemu.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	task, err := qemu.Shutdown()
+	if err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+	status, exitStatus, err := task.GetStatus()
+	if err != nil || status != "stopped" || exitStatus != "OK" {
+		t.Errorf("GetStatus() = %q, %q, %v", status, exitStatus, err)
+	}
+	if _, err = qemu.Config(); !IsNotFound(err) {
+		t.Errorf("Config without canned response: got %v, want an error matching ErrNotFound", err)
+	}
+
+	want := []string{
+		"GET nodes/pve/qemu",
+		"POST nodes/pve/qemu/100/status/start",
+		"POST nodes/pve/qemu/100/status/shutdown",
+		"GET nodes/pve/tasks/UPID:pve:4:5:6:qmshutdown:100:root@pam:/status",
+		"GET nodes/pve/qemu/100/config",
+	}
+	if !equalIDs(fake.requests, want...) {
+		t.Errorf("requests = %q, want %q", fake.requests, want)
+	}
+}
+
+// auditRequester wraps a Requester and records the endpoints of all writes.
+type auditRequester struct {
+	Requester
+	writes []string
+}
+
+func (a *auditRequester) Do(ctx context.Context, method string, endpoint string, params url.Values, out interface{}) error {
+	if method != "GET" {
+		a.writes = append(a.writes, method+" "+endpoint)
+	}
+	return a.Requester.Do(ctx, method, endpoint, params, out)
+}
+
+func TestNodeWithDecorator(t *testing.T) {
+	srv := newTestServer(t)
+	proxmox := newTestClient(t, srv)
+	audit := &auditRequester{Requester: proxmox}
+	node := Node{Node: proxmoxtest.DefaultNode, Proxmox: audit}
+
+	list, err := node.Qemu()
+	if err != nil {
+		t.Fatalf("Qemu: %v", err)
+	}
+	if len(list) != 0 {
+		t.Errorf("Qemu() = %+v, want no VMs", list)
+	}
+	task, err := node.NewVM().Name("web").Memory(1024).Create()
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if _, err = task.WaitForStatus("stopped", 10); err != nil {
+		t.Fatalf("WaitForStatus: %v", err)
+	}
+	if !equalIDs(audit.writes, "POST nodes/pve/qemu") {
+		t.Errorf("writes = %q, want [POST nodes/pve/qemu]", audit.writes)
+	}
+}
@@ -0,0 +1,34 @@
+package proxmox
+
+import (
+	"context"
+	"log/slog"
+)
+
+// discardHandler drops all records. It is used when no Logger has been set,
+// so the library stays silent by default.
+type discardHandler struct{}
+
+func (discardHandler) Enabled(context.Context, slog.Level) bool  { return false }
+func (discardHandler) Handle(context.Context, slog.Record) error { return nil }
+func (h discardHandler) WithAttrs([]slog.Attr) slog.Handler      { return h }
+func (h discardHandler) WithGroup(string) slog.Handler           { return h }
+
+var discardLogger = slog.New(discardHandler{})
+
+// log returns the configured Logger or a logger discarding everything.
+func (proxmox ProxMox) log() *slog.Logger {
+	if proxmox.Logger == nil {
+		return discardLogger
+	}
+	return proxmox.Logger
+}
+
+// logger returns the logger of api if it is a ProxMox client. Requests sent
+// through other implementations of Requester are not logged by the library.
+func logger(api Requester) *slog.Logger {
+	if proxmox, ok := api.(interface{ log() *slog.Logger }); ok {
+		return proxmox.log()
+	}
+	return discardLogger
+}
@@ -0,0 +1,81 @@
+package proxmox
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/joernott/go-proxmox/proxmoxtest"
+)
+
+// useClient runs requests which log a warning for a skipped offline node and
+// debug records for the requests, one of them failing.
+func useClient(t *testing.T, srv *proxmoxtest.Server, proxmox *ProxMox) {
+	t.Helper()
+	nodes, err := proxmox.Nodes()
+	if err != nil {
+		t.Fatalf("Nodes: %v", err)
+	}
+	_, err = nodes[proxmoxtest.DefaultNode].NewVM().VMId(100).Create()
+	if err == nil {
+		t.Error("Create of an existing VM: got no error")
+	}
+}
+
+func TestSilentByDefault(t *testing.T) {
+	var logged bytes.Buffer
+
+	srv := newTestServer(t)
+	srv.AddNode("pve2")
+	srv.SetNodeOnline("pve2", false)
+	srv.AddVM(proxmoxtest.VM{VMID: 100})
+
+	stdout := os.Stdout
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("Pipe: %v", err)
+	}
+	os.Stdout = w
+	defaultLogger := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&logged, &slog.HandlerOptions{Level: slog.LevelDebug})))
+	defer func() {
+		os.Stdout = stdout
+		slog.SetDefault(defaultLogger)
+	}()
+
+	useClient(t, srv, newTestClient(t, srv))
+	w.Close()
+	printed, _ := io.ReadAll(r)
+	if len(printed) > 0 {
+		t.Errorf("printed to stdout: %q", printed)
+	}
+	if logged.Len() > 0 {
+		t.Errorf("logged to the default logger: %q", logged.String())
+	}
+}
+
+func TestWithLogger(t *testing.T) {
+	var logged bytes.Buffer
+
+	srv := newTestServer(t)
+	srv.AddNode("pve2")
+	srv.SetNodeOnline("pve2", false)
+	srv.AddVM(proxmoxtest.VM{VMID: 100})
+	logger := slog.New(slog.NewTextHandler(&logged, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	useClient(t, srv, newTestClient(t, srv, WithLogger(logger)))
+	for _, want := range []string{
+		`level=WARN msg="Node probably down. Skipping." node=pve2`,
+		`level=DEBUG msg="Request done" method=GET endpoint=nodes`,
+		`level=DEBUG msg="Request done" method=POST endpoint=nodes/pve/qemu status=500`,
+		// Nodes log through the client they were created by.
+		`level=DEBUG msg="Error creating VM" node=pve vmid=100`,
+	} {
+		if !strings.Contains(logged.String(), want) {
+			t.Errorf("log does not contain %s:\n%s", want, logged.String())
+		}
+	}
+}
@@ -0,0 +1,206 @@
+package proxmox
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// MigrateOptions control a migration. Online is required to move a running
+// VM. Local disks are only copied with WithLocalDisks, to TargetStorage or,
+// per source storage, to the storage given in StorageMap. BWLimit is in
+// KiB/s, MigrationNetwork a CIDR like "10.1.2.0/24". Force allows migrating
+// VMs with local devices like passed through USB devices, only root may use
+// it.
+type MigrateOptions struct {
+	Online           bool
+	WithLocalDisks   bool
+	TargetStorage    string
+	StorageMap       map[string]string
+	BWLimit          int
+	MigrationNetwork string
+	MigrationType    string
+	Force            bool
+}
+
+// MigrationCheck is the result of the migration precondition check.
+// NotAllowedNodes lists the storages missing on the nodes which cannot take
+// the VM.
+type MigrationCheck struct {
+	Running         bool
+	AllowedNodes    []string
+	NotAllowedNodes map[string][]string
+	LocalDisks      []MigrationDisk
+	LocalResources  []string
+	MappedResources []string
+}
+
+type MigrationDisk struct {
+	VolId              string
+	Size               float64
+	CDROM              bool
+	IsUnused           bool
+	ReferencedInConfig bool
+}
+
+type migrationDiskData struct {
+	VolId              flexString `json:"volid"`
+	Size               flexFloat  `json:"size"`
+	CDROM              flexFloat  `json:"cdrom"`
+	IsUnused           flexFloat  `json:"is_unused"`
+	ReferencedInConfig flexFloat  `json:"referenced_in_config"`
+}
+
+type migrationCheckData struct {
+	Running         flexFloat                      `json:"running"`
+	AllowedNodes    []string                       `json:"allowed_nodes"`
+	NotAllowedNodes map[string]map[string][]string `json:"not_allowed_nodes"`
+	LocalDisks      []migrationDiskData            `json:"local_disks"`
+	LocalResources  []string                       `json:"local_resources"`
+	MappedResources []string                       `json:"mapped-resources"`
+}
+
+// Blockers returns the reasons why the VM cannot be migrated to target with
+// the given options. It is empty if nothing is known to prevent the move.
+func (check MigrationCheck) Blockers(target string, opts MigrateOptions) []string {
+	var blockers []string
+
+	if storages, ok := check.NotAllowedNodes[target]; ok {
+		if len(storages) > 0 {
+			blockers = append(blockers, "storage "+strings.Join(storages, ", ")+" not available on node "+target)
+		} else {
+			blockers = append(blockers, "node "+target+" not allowed")
+		}
+	}
+	if check.Running && !opts.Online {
+		blockers = append(blockers, "VM is running, online migration required")
+	}
+	if len(check.LocalResources) > 0 && !opts.Force {
+		blockers = append(blockers, "local resources "+strings.Join(check.LocalResources, ", "))
+	}
+	for _, disk := range check.LocalDisks {
+		if disk.CDROM {
+			blockers = append(blockers, "local CD-ROM "+disk.VolId)
+		} else if !opts.WithLocalDisks {
+			blockers = append(blockers, "local disk "+disk.VolId)
+		}
+	}
+	return blockers
+}
+
+func (qemu QemuVM) MigrateCheck(target string) (MigrationCheck, error) {
+	return qemu.MigrateCheckCtx(context.Background(), target)
+}
+
+// MigrateCheckCtx asks the node whether the VM can be migrated to target. An
+// empty target checks against all nodes.
+func (qemu QemuVM) MigrateCheckCtx(ctx context.Context, target string) (MigrationCheck, error) {
+	var err error
+	var params url.Values
+	var results migrationCheckData
+	var check MigrationCheck
+
+	params = url.Values{}
+	if target != "" {
+		params.Set("target", target)
+	}
+	err = qemu.Node.Proxmox.Do(ctx, "GET", "nodes/"+qemu.Node.Node+"/qemu/"+strconv.FormatFloat(qemu.VMId, 'f', 0, 64)+"/migrate", params, &results)
+	if err != nil {
+		return check, err
+	}
+	check = MigrationCheck{
+		Running:         results.Running != 0,
+		AllowedNodes:    results.AllowedNodes,
+		NotAllowedNodes: make(map[string][]string),
+		LocalResources:  results.LocalResources,
+		MappedResources: results.MappedResources,
+	}
+	for node, v := range results.NotAllowedNodes {
+		check.NotAllowedNodes[node] = v["unavailable_storages"]
+	}
+	for _, v := range results.LocalDisks {
+		check.LocalDisks = append(check.LocalDisks, MigrationDisk{
+			VolId:              string(v.VolId),
+			Size:               float64(v.Size),
+			CDROM:              v.CDROM != 0,
+			IsUnused:           v.IsUnused != 0,
+			ReferencedInConfig: v.ReferencedInConfig != 0,
+		})
+	}
+	return check, nil
+}
+
+func (qemu QemuVM) Migrate(target string, opts MigrateOptions) (Task, error) {
+	return qemu.MigrateCtx(context.Background(), target, opts)
+}
+
+// MigrateCtx moves the VM to the node target. The preconditions are checked
+// first and returned as error if the migration would fail.
+func (qemu QemuVM) MigrateCtx(ctx context.Context, target string, opts MigrateOptions) (Task, error) {
+	var err error
+	var check MigrationCheck
+	var blockers []string
+	var form url.Values
+	var vmid string
+	var UPid flexString
+
+	vmid = strconv.FormatFloat(qemu.VMId, 'f', 0, 64)
+	if target == "" || target == qemu.Node.Node {
+		return Task{}, errors.New("Invalid migration target " + target + " for VM " + vmid + ".")
+	}
+	check, err = qemu.MigrateCheckCtx(ctx, target)
+	if err != nil {
+		return Task{}, err
+	}
+	blockers = check.Blockers(target, opts)
+	if len(blockers) > 0 {
+		return Task{}, errors.New("VM " + vmid + " cannot be migrated to " + target + ": " + strings.Join(blockers, "; ") + ".")
+	}
+
+	form = url.Values{"target": {target}}
+	if opts.Online {
+		form.Set("online", "1")
+	}
+	if opts.WithLocalDisks {
+		form.Set("with-local-disks", "1")
+	}
+	if storages := opts.targetStorage(); storages != "" {
+		form.Set("targetstorage", storages)
+	}
+	if opts.BWLimit > 0 {
+		form.Set("bwlimit", strconv.Itoa(opts.BWLimit))
+	}
+	if opts.MigrationNetwork != "" {
+		form.Set("migration_network", opts.MigrationNetwork)
+	}
+	if opts.MigrationType != "" {
+		form.Set("migration_type", opts.MigrationType)
+	}
+	if opts.Force {
+		form.Set("force", "1")
+	}
+
+	err = qemu.Node.Proxmox.Do(ctx, "POST", "nodes/"+qemu.Node.Node+"/qemu/"+vmid+"/migrate", form, &UPid)
+	if err != nil {
+		return Task{}, err
+	}
+	return Task{UPid: string(UPid), ID: vmid, proxmox: qemu.Node.Proxmox}, nil
+}
+
+// targetStorage formats the storage mapping as "source:target" pairs with
+// TargetStorage as default for all other storages.
+func (opts MigrateOptions) targetStorage() string {
+	var pairs []string
+
+	for source, target := range opts.StorageMap {
+		pairs = append(pairs, source+":"+target)
+	}
+	sort.Strings(pairs)
+	if opts.TargetStorage != "" {
+		pairs = append(pairs, opts.TargetStorage)
+	}
+	return strings.Join(pairs, ",")
+}
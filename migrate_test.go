@@ -0,0 +1,148 @@
+package proxmox
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/joernott/go-proxmox/proxmoxtest"
+)
+
+func newMigrateServer(t *testing.T) *proxmoxtest.Server {
+	t.Helper()
+	srv := newTestServer(t)
+	srv.AddNode("pve2")
+	srv.AddNode("pve3")
+	srv.SetNodeOnline("pve3", false)
+	srv.AddStorage(proxmoxtest.Storage{Name: "local-lvm", Type: "lvmthin", Content: "images", Total: 100 << 30,
+		Volumes: map[string]int64{"local-lvm:vm-100-disk-0": 8 << 30}})
+	srv.AddStorage(proxmoxtest.Storage{Name: "ceph", Type: "rbd", Content: "images", Shared: true, Total: 1 << 40,
+		Volumes: map[string]int64{"ceph:vm-101-disk-0": 8 << 30, "ceph:vm-102-disk-0": 8 << 30}})
+	srv.AddVM(proxmoxtest.VM{VMID: 100, Status: "running", Config: map[string]string{
+		"scsi0":    "local-lvm:vm-100-disk-0,size=8G",
+		"ide2":     "local:iso/debian-12.iso,media=cdrom",
+		"hostpci0": "0000:01:00",
+	}})
+	srv.AddVM(proxmoxtest.VM{VMID: 101, Status: "stopped", Config: map[string]string{"scsi0": "ceph:vm-101-disk-0,size=8G"}})
+	srv.AddVM(proxmoxtest.VM{VMID: 102, Status: "running", Config: map[string]string{"scsi0": "ceph:vm-102-disk-0,size=8G"}})
+	return srv
+}
+
+func TestMigrateCheck(t *testing.T) {
+	srv := newMigrateServer(t)
+	proxmox := newTestClient(t, srv)
+	qemu, err := proxmox.FindVM("100")
+	if err != nil {
+		t.Fatalf("FindVM: %v", err)
+	}
+
+	check, err := qemu.MigrateCheck("")
+	if err != nil {
+		t.Fatalf("MigrateCheck: %v", err)
+	}
+	if !check.Running {
+		t.Error("Running = false, want true")
+	}
+	if !reflect.DeepEqual(check.AllowedNodes, []string{"pve2"}) {
+		t.Errorf("AllowedNodes = %v, want [pve2]", check.AllowedNodes)
+	}
+	if storages, ok := check.NotAllowedNodes["pve3"]; !ok || len(storages) != 0 || len(check.NotAllowedNodes) != 1 {
+		t.Errorf("NotAllowedNodes = %v, want pve3 without storages", check.NotAllowedNodes)
+	}
+	if !reflect.DeepEqual(check.LocalResources, []string{"hostpci0"}) {
+		t.Errorf("LocalResources = %v, want [hostpci0]", check.LocalResources)
+	}
+	disks := []MigrationDisk{
+		{VolId: "local:iso/debian-12.iso", CDROM: true, ReferencedInConfig: true},
+		{VolId: "local-lvm:vm-100-disk-0", Size: 8 << 30, ReferencedInConfig: true},
+	}
+	if !reflect.DeepEqual(check.LocalDisks, disks) {
+		t.Errorf("LocalDisks = %+v, want %+v", check.LocalDisks, disks)
+	}
+
+	tests := []struct {
+		name   string
+		target string
+		opts   MigrateOptions
+		want   []string
+	}{
+		{name: "no options", target: "pve2", want: []string{
+			"VM is running, online migration required",
+			"local resources hostpci0",
+			"local CD-ROM local:iso/debian-12.iso",
+			"local disk local-lvm:vm-100-disk-0",
+		}},
+		{name: "all options", target: "pve2", opts: MigrateOptions{Online: true, WithLocalDisks: true, Force: true}, want: []string{
+			"local CD-ROM local:iso/debian-12.iso",
+		}},
+		{name: "offline node", target: "pve3", opts: MigrateOptions{Online: true, WithLocalDisks: true, Force: true}, want: []string{
+			"node pve3 not allowed",
+			"local CD-ROM local:iso/debian-12.iso",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := check.Blockers(tt.target, tt.opts); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Blockers = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	check = MigrationCheck{NotAllowedNodes: map[string][]string{"pve2": {"local-lvm", "nfs"}}}
+	want := []string{"storage local-lvm, nfs not available on node pve2"}
+	if got := check.Blockers("pve2", MigrateOptions{}); !reflect.DeepEqual(got, want) {
+		t.Errorf("Blockers with missing storages = %q, want %q", got, want)
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	srv := newMigrateServer(t)
+	proxmox := newTestClient(t, srv)
+	find := func(vmid string) QemuVM {
+		t.Helper()
+		qemu, err := proxmox.FindVM(vmid)
+		if err != nil {
+			t.Fatalf("FindVM: %v", err)
+		}
+		return qemu
+	}
+
+	// The blockers are reported without starting a migration.
+	_, err := find("100").Migrate("pve2", MigrateOptions{Online: true, WithLocalDisks: true, Force: true})
+	want := "VM 100 cannot be migrated to pve2: local CD-ROM local:iso/debian-12.iso."
+	if err == nil || err.Error() != want {
+		t.Errorf("Migrate of 100: got %v, want %q", err, want)
+	}
+	_, err = find("102").Migrate("pve2", MigrateOptions{})
+	want = "VM 102 cannot be migrated to pve2: VM is running, online migration required."
+	if err == nil || err.Error() != want {
+		t.Errorf("offline Migrate of running 102: got %v, want %q", err, want)
+	}
+	_, err = find("101").Migrate(proxmoxtest.DefaultNode, MigrateOptions{})
+	if err == nil {
+		t.Error("Migrate to its own node: got no error")
+	}
+	if tasks := srv.Tasks(); len(tasks) != 0 {
+		t.Errorf("Tasks = %v, want none", tasks)
+	}
+
+	tests := []struct {
+		vmid string
+		opts MigrateOptions
+	}{
+		{vmid: "101"},
+		{vmid: "102", opts: MigrateOptions{Online: true}},
+	}
+	for _, tt := range tests {
+		task, err := find(tt.vmid).Migrate("pve2", tt.opts)
+		if err != nil {
+			t.Errorf("Migrate of %s: %v", tt.vmid, err)
+			continue
+		}
+		if _, err = task.WaitForStatus("stopped", 5); err != nil {
+			t.Errorf("WaitForStatus of %s: %v", tt.vmid, err)
+		}
+		if qemu := find(tt.vmid); qemu.Node.Node != "pve2" {
+			t.Errorf("VM %s is on %s after the migration, want pve2", tt.vmid, qemu.Node.Node)
+		}
+	}
+}
@@ -1,7 +1,8 @@
 package proxmox
 
 import (
-	"fmt"
+	"context"
+	"errors"
 	"net/url"
 	"strconv"
 )
@@ -18,7 +19,8 @@ type Node struct {
 	NodeType string  `json:"nodetype"`
 	Disk     float64 `json:"disk"`
 	MaxMem   float64 `json:"maxmem"`
-	Proxmox  ProxMox
+	Status   string  `json:"status"`
+	Proxmox  Requester
 }
 
 type NodeList map[string]Node
@@ -27,60 +29,64 @@ type NodeListResult struct {
 	Data NodeList `json:"data"`
 }
 
+// nodeData is a node as sent by the API. Uptime is missing for nodes which
+// are down.
+type nodeData struct {
+	Mem      flexFloat  `json:"mem"`
+	MaxDisk  flexFloat  `json:"maxdisk"`
+	Node     flexString `json:"node"`
+	MaxCPU   flexFloat  `json:"maxcpu"`
+	Uptime   *flexFloat `json:"uptime"`
+	Id       flexString `json:"id"`
+	CPU      flexFloat  `json:"cpu"`
+	Level    flexString `json:"level"`
+	NodeType flexString `json:"type"`
+	Disk     flexFloat  `json:"disk"`
+	MaxMem   flexFloat  `json:"maxmem"`
+	Status   flexString `json:"status"`
+}
+
+func (v nodeData) node(api Requester) Node {
+	node := Node{
+		Mem:      float64(v.Mem),
+		MaxDisk:  float64(v.MaxDisk),
+		Node:     string(v.Node),
+		MaxCPU:   float64(v.MaxCPU),
+		Id:       string(v.Id),
+		CPU:      float64(v.CPU),
+		Level:    string(v.Level),
+		NodeType: string(v.NodeType),
+		Disk:     float64(v.Disk),
+		MaxMem:   float64(v.MaxMem),
+		Status:   string(v.Status),
+		Proxmox:  api,
+	}
+	if v.Uptime != nil {
+		node.Uptime = float64(*v.Uptime)
+	}
+	return node
+}
+
 func (node Node) Qemu() (QemuList, error) {
+	return node.QemuCtx(context.Background())
+}
+
+func (node Node) QemuCtx(ctx context.Context) (QemuList, error) {
 	var err error
-	var data map[string]interface{}
+	var results []qemuData
 	var list QemuList
 	var vm QemuVM
-	var results []interface{}
-	var VMIdFloat float64
 
 	//fmt.Println("!Qemu")
 
-	data, err = node.Proxmox.Get("nodes/" + node.Node + "/qemu")
+	err = node.Proxmox.Do(ctx, "GET", "nodes/"+node.Node+"/qemu", nil, &results)
 	if err != nil {
 		return nil, err
 	}
 
 	list = make(QemuList)
-	results = data["data"].([]interface{})
-	for _, v0 := range results {
-		v := v0.(map[string]interface{})
-		if _, ok := v["vmid"].(string); ok {
-			VMIdFloat, err = strconv.ParseFloat(v["vmid"].(string), 64)
-			if err != nil {
-				return nil, err
-			}
-		} else {
-			VMIdFloat = v["vmid"].(float64)
-		}
-
-		vm = QemuVM{
-			Mem:    v["mem"].(float64),
-			CPUs:   v["cpus"].(float64),
-			NetOut: v["netout"].(float64),
-			//			PID:       v["pid"].(string),
-			Disk:      v["disk"].(float64),
-			MaxMem:    v["maxmem"].(float64),
-			Status:    v["status"].(string),
-			NetIn:     v["netin"].(float64),
-			MaxDisk:   v["maxdisk"].(float64),
-			Name:      v["name"].(string),
-			DiskWrite: v["diskwrite"].(float64),
-			CPU:       v["cpu"].(float64),
-			VMId:      VMIdFloat,
-			DiskRead:  v["diskread"].(float64),
-			Uptime:    v["uptime"].(float64),
-			Node:      node,
-		}
-
-		switch v["template"].(type) {
-		case float64:
-			vm.Template = v["template"].(float64)
-		default:
-			vm.Template = 0
-		}
-
+	for _, v := range results {
+		vm = v.qemu(node)
 		list[strconv.FormatFloat(vm.VMId, 'f', 0, 64)] = vm
 	}
 
@@ -88,6 +94,10 @@ func (node Node) Qemu() (QemuList, error) {
 }
 
 func (node Node) MaxQemuId() (float64, error) {
+	return node.MaxQemuIdCtx(context.Background())
+}
+
+func (node Node) MaxQemuIdCtx(ctx context.Context) (float64, error) {
 	var list QemuList
 	var vm QemuVM
 	var id float64
@@ -96,7 +106,7 @@ func (node Node) MaxQemuId() (float64, error) {
 	//fmt.Println("!MaxQemuId")
 
 	id = 1009
-	list, err = node.Qemu()
+	list, err = node.QemuCtx(ctx)
 	if err != nil {
 		return 0, err
 	}
@@ -110,33 +120,24 @@ func (node Node) MaxQemuId() (float64, error) {
 }
 
 func (node Node) Storages() (StorageList, error) {
+	return node.StoragesCtx(context.Background())
+}
+
+func (node Node) StoragesCtx(ctx context.Context) (StorageList, error) {
 	var err error
-	var data map[string]interface{}
+	var results []storageData
 	var list StorageList
 	var storage Storage
-	var results []interface{}
 
 	//fmt.Println("!Storages")
 
-	data, err = node.Proxmox.Get("nodes/" + node.Node + "/storage")
+	err = node.Proxmox.Do(ctx, "GET", "nodes/"+node.Node+"/storage", nil, &results)
 	if err != nil {
 		return nil, err
 	}
 	list = make(StorageList)
-	results = data["data"].([]interface{})
-	for _, v0 := range results {
-		v := v0.(map[string]interface{})
-		storage = Storage{
-			StorageType: v["type"].(string),
-			Active:      v["active"].(float64),
-			Total:       v["total"].(float64),
-			Content:     v["content"].(string),
-			Shared:      v["shared"].(float64),
-			Storage:     v["storage"].(string),
-			Used:        v["used"].(float64),
-			Avail:       v["avail"].(float64),
-			Node:        node,
-		}
+	for _, v := range results {
+		storage = v.storage(node)
 		list[storage.Storage] = storage
 	}
 
@@ -144,28 +145,42 @@ func (node Node) Storages() (StorageList, error) {
 }
 
 func (node Node) CreateQemuVM(Name string, Sockets int, Cores int, MemorySize int, DiskSize string) (string, error) {
+	return node.CreateQemuVMCtx(context.Background(), Name, Sockets, Cores, MemorySize, DiskSize)
+}
+
+func (node Node) CreateQemuVMCtx(ctx context.Context, Name string, Sockets int, Cores int, MemorySize int, DiskSize string) (string, error) {
 	var err error
 	var newVmId string
 	var storageList StorageList
-	//var storage Storage
+	var storage Storage
 	var results map[string]interface{}
 	var storageId string
+	var ok bool
 	var form url.Values
 	var target string
 
 	//fmt.Println("!CreateQemuVM")
 
-	newVmId, err = node.Proxmox.NextVMId()
+	newVmId, err = nextVMId(ctx, node.Proxmox)
 	if err != nil {
 		return "", err
 	}
 	//fmt.Println("new VM ID: " + newVmId)
-	storageList, err = node.Storages()
-	results, err = storageList["local"].CreateVolume("vm-"+newVmId+"-disk-0.qcow2", DiskSize, newVmId)
+	storageList, err = node.StoragesCtx(ctx)
+	if err != nil {
+		return "", err
+	}
+	if storage, ok = storageList["local"]; !ok {
+		return "", errors.New("Storage local not found on node " + node.Node + ".")
+	}
+	results, err = storage.CreateVolumeCtx(ctx, "vm-"+newVmId+"-disk-0.qcow2", DiskSize, newVmId)
 	if err != nil {
 		return "", err
 	}
-	storageId = results["data"].(string)
+	storageId, ok = results["data"].(string)
+	if !ok {
+		return "", errors.New("No volume ID received for VM " + newVmId + ".")
+	}
 
 	//fmt.Println("!CreateVolume")
 
@@ -182,9 +197,9 @@ func (node Node) CreateQemuVM(Name string, Sockets int, Cores int, MemorySize in
 	}
 
 	target = "nodes/" + node.Node + "/qemu"
-	results, err = node.Proxmox.PostForm(target, form)
+	err = node.Proxmox.Do(ctx, "POST", target, form, nil)
 	if err != nil {
-		fmt.Println("Error creating VM!!!")
+		logger(node.Proxmox).DebugContext(ctx, "Error creating VM", "node", node.Node, "vmid", newVmId, "error", err)
 		return "", err
 	}
 	//fmt.Println("VM " + newVmId + " created")
@@ -193,10 +208,14 @@ func (node Node) CreateQemuVM(Name string, Sockets int, Cores int, MemorySize in
 }
 
 func (node Node) VZDump(VmId string, BWLimit int, Compress string, IONice int, LockWait int, Mode string) (string, error) {
+	return node.VZDumpCtx(context.Background(), VmId, BWLimit, Compress, IONice, LockWait, Mode)
+}
+
+func (node Node) VZDumpCtx(ctx context.Context, VmId string, BWLimit int, Compress string, IONice int, LockWait int, Mode string) (string, error) {
 	var form url.Values
 	var target string
 	var err error
-	var results map[string]interface{}
+	var UPid flexString
 
 	form = url.Values{
 		"vmid":     {VmId},
@@ -211,56 +230,46 @@ func (node Node) VZDump(VmId string, BWLimit int, Compress string, IONice int, L
 		form.Set("ionice", strconv.Itoa(IONice))
 	}
 	target = "nodes/" + node.Node + "/vzdump"
-	results, err = node.Proxmox.PostForm(target, form)
+	err = node.Proxmox.Do(ctx, "POST", target, form, &UPid)
 	if err != nil {
-		fmt.Println("Error dumping VM!")
+		logger(node.Proxmox).DebugContext(ctx, "Error dumping VM", "node", node.Node, "vmid", VmId, "error", err)
 		return "", err
 	}
-	return results["data"].(string), nil
+	return string(UPid), nil
 }
 
 func (node Node) Tasks(Limit int, Start int, UserFilter string, VmId string) (TaskList, error) {
+	return node.TasksCtx(context.Background(), Limit, Start, UserFilter, VmId)
+}
+
+func (node Node) TasksCtx(ctx context.Context, Limit int, Start int, UserFilter string, VmId string) (TaskList, error) {
 	var err error
-	var target string
-	var data map[string]interface{}
+	var params url.Values
 	var list TaskList
 	var task Task
-	var results []interface{}
+	var results []taskData
 
 	//fmt.Println("!Tasks")
-	target = "nodes/" + node.Node + "/tasks?"
+	params = url.Values{}
 	if Limit > 0 {
-		target = target + "limit=" + strconv.Itoa(Limit) + "&"
+		params.Set("limit", strconv.Itoa(Limit))
 	}
 	if Start > 0 {
-		target = target + "start=" + strconv.Itoa(Start) + "&"
+		params.Set("start", strconv.Itoa(Start))
 	}
 	if UserFilter != "" {
-		target = target + "userfilter=" + UserFilter + "&"
+		params.Set("userfilter", UserFilter)
 	}
 	if VmId != "" {
-		target = target + "vmid=" + VmId + "&"
+		params.Set("vmid", VmId)
 	}
-	target = target[0 : len(target)-1]
-	data, err = node.Proxmox.Get(target)
+	err = node.Proxmox.Do(ctx, "GET", "nodes/"+node.Node+"/tasks", params, &results)
 	if err != nil {
 		return nil, err
 	}
 	list = make(TaskList)
-	results = data["data"].([]interface{})
-	for _, v0 := range results {
-		v := v0.(map[string]interface{})
-		task = Task{
-			UPid:      v["upid"].(string),
-			Type:      v["type"].(string),
-			Status:    v["status"].(string),
-			PID:       v["pid"].(float64),
-			PStart:    v["pstart"].(float64),
-			StartTime: v["starttime"].(float64),
-			EndTime:   v["endtime"].(float64),
-			ID:        v["id"].(string),
-			proxmox:   node.Proxmox,
-		}
+	for _, v := range results {
+		task = v.task(node.Proxmox)
 		list[task.UPid] = task
 	}
 
@@ -0,0 +1,148 @@
+package proxmox
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const (
+	DefaultPort    = 8006
+	DefaultRealm   = "pam"
+	DefaultTimeout = time.Second * 10
+)
+
+// Option configures a ProxMox client created with New.
+type Option func(*options) error
+
+type options struct {
+	username  string
+	password  string
+	tokenID   string
+	secret    string
+	realm     string
+	port      int
+	timeout   time.Duration
+	client    *http.Client
+	transport http.RoundTripper
+	userAgent string
+	proxy     *url.URL
+	tls       TLSOptions
+	logger    *slog.Logger
+	failover  []string
+	retry     *RetryPolicy
+}
+
+func defaultOptions() *options {
+	return &options{
+		realm:   DefaultRealm,
+		port:    DefaultPort,
+		timeout: DefaultTimeout,
+	}
+}
+
+// WithPassword logs in with user name and password and uses the resulting
+// ticket for all requests.
+func WithPassword(UserName string, Password string) Option {
+	return func(o *options) error {
+		o.username = UserName
+		o.password = Password
+		return nil
+	}
+}
+
+// WithAPIToken authenticates every request with an API token. TokenID has the
+// form user@realm!tokenid.
+func WithAPIToken(TokenID string, Secret string) Option {
+	return func(o *options) error {
+		o.tokenID = TokenID
+		o.secret = Secret
+		return nil
+	}
+}
+
+// WithRealm sets the realm used for user names without one. Defaults to pam.
+func WithRealm(realm string) Option {
+	return func(o *options) error {
+		if realm == "" {
+			return errors.New("Realm must not be empty.")
+		}
+		o.realm = realm
+		return nil
+	}
+}
+
+// WithPort sets the port used for host names without one. Defaults to 8006.
+func WithPort(port int) Option {
+	return func(o *options) error {
+		if port <= 0 || port > 65535 {
+			return errors.New("Invalid port.")
+		}
+		o.port = port
+		return nil
+	}
+}
+
+// WithTimeout sets the timeout of the HTTP client. Zero disables it, so only
+// the deadline of the context passed to the Ctx methods applies.
+func WithTimeout(timeout time.Duration) Option {
+	return func(o *options) error {
+		o.timeout = timeout
+		return nil
+	}
+}
+
+// WithHTTPClient uses a copy of the given client instead of building one. The
+// copy gets its own cookie jar. Timeout, transport, proxy and TLS options are
+// not applied to it.
+func WithHTTPClient(client *http.Client) Option {
+	return func(o *options) error {
+		o.client = client
+		return nil
+	}
+}
+
+// WithTransport uses the given RoundTripper for the HTTP client. Proxy and
+// TLS options are not applied to it. The default transport keeps up to 100
+// idle connections per host, pass an *http.Transport to change the pool
+// sizes or idle timeouts.
+func WithTransport(transport http.RoundTripper) Option {
+	return func(o *options) error {
+		o.transport = transport
+		return nil
+	}
+}
+
+func WithUserAgent(userAgent string) Option {
+	return func(o *options) error {
+		o.userAgent = userAgent
+		return nil
+	}
+}
+
+func WithProxy(proxyURL string) Option {
+	return func(o *options) error {
+		u, err := url.Parse(proxyURL)
+		if err != nil {
+			return err
+		}
+		o.proxy = u
+		return nil
+	}
+}
+
+func WithTLS(TLS TLSOptions) Option {
+	return func(o *options) error {
+		o.tls = TLS
+		return nil
+	}
+}
+
+func WithLogger(logger *slog.Logger) Option {
+	return func(o *options) error {
+		o.logger = logger
+		return nil
+	}
+}
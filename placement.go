@@ -0,0 +1,108 @@
+package proxmox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+)
+
+// nodeUsage is the capacity of a node and the CPUs and memory assigned to the
+// VMs on it, including stopped ones.
+type nodeUsage struct {
+	node     Node
+	usedCPUs int64
+	usedMem  int64
+}
+
+// free returns the CPUs and memory left with the given overcommitment.
+func (u *nodeUsage) free(overCommitCPU float64, overCommitMem float64) (int64, int64) {
+	return int64(u.node.MaxCPU*(1+overCommitCPU)) - u.usedCPUs, int64(u.node.MaxMem*(1+overCommitMem)) - u.usedMem
+}
+
+// nodeUsages returns the usage of all online nodes except those in exclude.
+func nodeUsages(ctx context.Context, api Requester, exclude ...string) (map[string]*nodeUsage, error) {
+	var resources Resources
+	var usages map[string]*nodeUsage
+	var err error
+
+	resources, err = clusterResources(ctx, api, ResourceAll)
+	if err != nil {
+		return nil, err
+	}
+	usages = make(map[string]*nodeUsage)
+	for name, node := range resources.Nodes {
+		if node.Status == "online" {
+			usages[name] = &nodeUsage{node: node}
+		}
+	}
+	for _, name := range exclude {
+		delete(usages, name)
+	}
+	for _, qemu := range resources.VMs {
+		if u, ok := usages[qemu.Node.Node]; ok {
+			u.usedCPUs = u.usedCPUs + int64(qemu.CPUs)
+			u.usedMem = u.usedMem + int64(qemu.MaxMem)
+		}
+	}
+	return usages, nil
+}
+
+// fits reports whether the node can take a VM with the given number of CPUs
+// and memory.
+func (u *nodeUsage) fits(cpus int64, mem int64, overCommitCPU float64, overCommitMem float64) bool {
+	freeCPUs, freeMem := u.free(overCommitCPU, overCommitMem)
+	return cpus < freeCPUs && mem < freeMem
+}
+
+// place returns the node with the most free memory which can take a VM with
+// the given number of CPUs and memory, or nil if none can. Evacuate uses it to
+// spread the VMs of a node across the cluster.
+func place(usages map[string]*nodeUsage, cpus int64, mem int64, overCommitCPU float64, overCommitMem float64) *nodeUsage {
+	var best *nodeUsage
+	var bestMem int64
+
+	for _, u := range usages {
+		if !u.fits(cpus, mem, overCommitCPU, overCommitMem) {
+			continue
+		}
+		_, freeMem := u.free(overCommitCPU, overCommitMem)
+		if best == nil || freeMem > bestMem || (freeMem == bestMem && u.node.Node < best.node.Node) {
+			best = u
+			bestMem = freeMem
+		}
+	}
+	return best
+}
+
+func (proxmox ProxMox) DetermineVMPlacement(cpu int64, cores int64, mem int64, overCommitCPU float64, overCommitMem float64) (Node, error) {
+	return proxmox.DetermineVMPlacementCtx(context.Background(), cpu, cores, mem, overCommitCPU, overCommitMem)
+}
+
+// DetermineVMPlacementCtx returns an online node which has room for a VM with
+// cpu sockets of cores and mem bytes of memory. The nodes are tried in random
+// order and the first one that fits is returned. The overcommitment factors
+// allow assigning more than the node has, e.g. 0.5 for 150%.
+func (proxmox ProxMox) DetermineVMPlacementCtx(ctx context.Context, cpu int64, cores int64, mem int64, overCommitCPU float64, overCommitMem float64) (Node, error) {
+	var usages map[string]*nodeUsage
+	var names []string
+	var errNode Node
+	var err error
+
+	usages, err = nodeUsages(ctx, proxmox)
+	if err != nil {
+		return errNode, fmt.Errorf("Could not get any nodes: %w", err)
+	}
+	for name := range usages {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	//Randomize order of nodes
+	for _, i := range rand.Perm(len(names)) {
+		if usages[names[i]].fits(cpu*cores, mem, overCommitCPU, overCommitMem) {
+			return usages[names[i]].node, nil
+		}
+	}
+	return errNode, errors.New("Not enough free capacity on any of the nodes.")
+}
@@ -0,0 +1,115 @@
+package proxmox
+
+import (
+	"testing"
+
+	"github.com/joernott/go-proxmox/proxmoxtest"
+)
+
+func TestDetermineVMPlacement(t *testing.T) {
+	srv := newTestServer(t)
+	srv.AddNode("pve2").MaxMem = 24 << 30
+	srv.AddNode("pve3").MaxMem = 64 << 30
+	srv.SetNodeOnline("pve3", false)
+	srv.AddVM(proxmoxtest.VM{VMID: 100, Config: map[string]string{"memory": "16384", "cores": "4"}})
+	proxmox := newTestClient(t, srv)
+
+	tests := []struct {
+		name    string
+		cpu     int64
+		cores   int64
+		mem     int64
+		overMem float64
+		want    string
+	}{
+		// pve has 16 GiB left, pve2 24 GiB and pve3 is offline.
+		{name: "only one fits", cpu: 1, cores: 2, mem: 20 << 30, want: "pve2"},
+		{name: "too many CPUs", cpu: 2, cores: 4, mem: 1 << 30, want: ""},
+		{name: "too much memory", cpu: 1, cores: 1, mem: 40 << 30, want: ""},
+		// With 50% overcommitment, pve has 32 GiB left and pve2 36 GiB.
+		{name: "overcommitted", cpu: 1, cores: 1, mem: 34 << 30, overMem: 0.5, want: "pve2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			node, err := proxmox.DetermineVMPlacement(tt.cpu, tt.cores, tt.mem, 0, tt.overMem)
+			if tt.want == "" {
+				if err == nil {
+					t.Errorf("got node %s, want an error", node.Node)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("DetermineVMPlacement: %v", err)
+			}
+			if node.Node != tt.want {
+				t.Errorf("got node %s, want %s", node.Node, tt.want)
+			}
+		})
+	}
+}
+
+// TestDetermineVMPlacementRandom checks that any node that fits is taken, not
+// always the same one.
+func TestDetermineVMPlacementRandom(t *testing.T) {
+	srv := newTestServer(t)
+	srv.AddNode("pve2")
+	proxmox := newTestClient(t, srv)
+
+	chosen := make(map[string]int)
+	for i := 0; i < 50; i++ {
+		node, err := proxmox.DetermineVMPlacement(1, 1, 1<<30, 0, 0)
+		if err != nil {
+			t.Fatalf("DetermineVMPlacement: %v", err)
+		}
+		chosen[node.Node]++
+	}
+	if len(chosen) != 2 {
+		t.Errorf("chosen nodes = %v, want both pve and pve2", chosen)
+	}
+}
+
+func TestPlace(t *testing.T) {
+	usages := map[string]*nodeUsage{
+		"pve":  {node: Node{Node: "pve", MaxCPU: 8, MaxMem: 32 << 30}, usedCPUs: 2, usedMem: 16 << 30},
+		"pve2": {node: Node{Node: "pve2", MaxCPU: 8, MaxMem: 24 << 30}},
+		"pve3": {node: Node{Node: "pve3", MaxCPU: 8, MaxMem: 24 << 30}, usedCPUs: 7},
+	}
+
+	tests := []struct {
+		name    string
+		cpus    int64
+		mem     int64
+		overMem float64
+		want    string
+	}{
+		// pve3 has the CPUs left for none of them.
+		{name: "most free memory", cpus: 1, mem: 8 << 30, want: "pve2"},
+		// With 100% overcommitment, all have 48 GiB left.
+		{name: "tie", cpus: 1, mem: 8 << 30, overMem: 1, want: "pve"},
+		{name: "none", cpus: 1, mem: 32 << 30, want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+
+			if u := place(usages, tt.cpus, tt.mem, 0, tt.overMem); u != nil {
+				got = u.node.Node
+			}
+			if got != tt.want {
+				t.Errorf("place = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDetermineVMPlacementError(t *testing.T) {
+	srv := newTestServer(t)
+	proxmox := newTestClient(t, srv)
+
+	srv.ExpireTickets()
+	srv.AddUser(proxmoxtest.DefaultUser, "changed")
+	_, err := proxmox.DetermineVMPlacement(1, 1, 1<<30, 0, 0)
+	if !IsUnauthorized(err) {
+		t.Errorf("got %v, want an error matching ErrUnauthorized", err)
+	}
+}
@@ -2,7 +2,7 @@ package proxmox
 
 type Pool struct {
 	Poolid  string `json:"poolid"`
-	proxmox ProxMox
+	proxmox Requester
 }
 
 type PoolList map[string]Pool
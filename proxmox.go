@@ -1,142 +1,271 @@
 package proxmox
 
 import (
-	"bytes"
+	"context"
 	"crypto/tls"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io/ioutil"
-	"math/rand"
+	"log/slog"
 	"net/http"
 	"net/http/cookiejar"
 	"net/url"
-	"strconv"
 	"strings"
-	"time"
 )
 
 type ProxMox struct {
-	Hostname                      string
-	Username                      string
-	password                      string
-	VerifySSL                     bool
-	BaseURL                       string
-	connectionCSRFPreventionToken string
-	ConnectionTicket              string
-	Client                        *http.Client
+	Hostname         string
+	Username         string
+	password         string
+	BaseURL          string
+	ConnectionTicket string
+	apiToken         string
+	session          *session
+	endpoints        *endpoints
+	retry            *RetryPolicy
+	userAgent        string
+	Client           *http.Client
+	Logger           *slog.Logger
+
+	// Deprecated: VerifySSL only reports whether the certificate of the node
+	// is checked, as set with WithTLS. It is false if the HTTP client or
+	// transport was passed in, changing it has no effect.
+	VerifySSL bool
 }
 
 func NewProxMox(HostName string, UserName string, Password string) (*ProxMox, error) {
+	return NewProxMoxCtx(context.Background(), HostName, UserName, Password)
+}
+
+func NewProxMoxCtx(ctx context.Context, HostName string, UserName string, Password string) (*ProxMox, error) {
+	return NewCtx(ctx, HostName, WithPassword(UserName, Password))
+}
+
+func NewProxMoxTLS(HostName string, UserName string, Password string, TLS TLSOptions) (*ProxMox, error) {
+	return NewProxMoxTLSCtx(context.Background(), HostName, UserName, Password, TLS)
+}
+
+func NewProxMoxTLSCtx(ctx context.Context, HostName string, UserName string, Password string, TLS TLSOptions) (*ProxMox, error) {
+	return NewCtx(ctx, HostName, WithPassword(UserName, Password), WithTLS(TLS))
+}
+
+// NewProxMoxWithToken authenticates every request with an API token instead
+// of a login ticket. TokenID has the form user@realm!tokenid.
+func NewProxMoxWithToken(HostName string, TokenID string, Secret string) (*ProxMox, error) {
+	return NewProxMoxWithTokenCtx(context.Background(), HostName, TokenID, Secret)
+}
+
+func NewProxMoxWithTokenCtx(ctx context.Context, HostName string, TokenID string, Secret string) (*ProxMox, error) {
+	return NewCtx(ctx, HostName, WithAPIToken(TokenID, Secret))
+}
+
+func NewProxMoxWithTokenTLS(HostName string, TokenID string, Secret string, TLS TLSOptions) (*ProxMox, error) {
+	return NewProxMoxWithTokenTLSCtx(context.Background(), HostName, TokenID, Secret, TLS)
+}
+
+func NewProxMoxWithTokenTLSCtx(ctx context.Context, HostName string, TokenID string, Secret string, TLS TLSOptions) (*ProxMox, error) {
+	return NewCtx(ctx, HostName, WithAPIToken(TokenID, Secret), WithTLS(TLS))
+}
+
+// New creates a client for the given host configured by options. Exactly one
+// of WithPassword and WithAPIToken has to be given.
+func New(HostName string, opts ...Option) (*ProxMox, error) {
+	return NewCtx(context.Background(), HostName, opts...)
+}
+
+func NewCtx(ctx context.Context, HostName string, opts ...Option) (*ProxMox, error) {
 	var err error
 	var proxmox *ProxMox
-	var data map[string]interface{}
-	var form url.Values
-	var cookies []*http.Cookie
-	var tr *http.Transport
-	var domain string
+	var o *options
 	//fmt.Println("!NewProxMox")
 
-	if !strings.Contains(UserName, "@") {
-		UserName = UserName + "@pam"
+	o = defaultOptions()
+	for _, opt := range opts {
+		err = opt(o)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if (o.username == "") == (o.tokenID == "") {
+		return nil, errors.New("Either a user name and password or an API token is required.")
 	}
 
-	if !strings.HasPrefix(HostName, "http") && !strings.HasPrefix(HostName, "https") {
-		HostName = "https://" + HostName
+	proxmox, err = newProxMox(HostName, o)
+	if err != nil {
+		return nil, err
 	}
 
-	proxmox = new(ProxMox)
-	proxmox.Hostname = HostName
-	proxmox.Username = UserName
-	proxmox.password = Password
-	proxmox.VerifySSL = false
-	if len(strings.Split(proxmox.Hostname, ":")) == 1 {
-		proxmox.BaseURL = proxmox.Hostname + ":8006"
+	if o.tokenID != "" {
+		TokenID := o.tokenID
+		if !strings.Contains(TokenID, "!") {
+			return nil, errors.New("Token ID " + TokenID + " is not of the form user@realm!tokenid.")
+		}
+		if !strings.Contains(TokenID, "@") {
+			TokenID = strings.Replace(TokenID, "!", "@"+o.realm+"!", 1)
+		}
+		proxmox.Username = TokenID[0:strings.Index(TokenID, "!")]
+		proxmox.apiToken = TokenID + "=" + o.secret
+
+		_, err = proxmox.GetCtx(ctx, "version")
+		if err != nil {
+			return nil, err
+		}
+		return proxmox, nil
 	}
-	proxmox.BaseURL = proxmox.Hostname + "/api2/json/"
 
-	if proxmox.VerifySSL {
-		tr = &http.Transport{
-			DisableKeepAlives:   false,
-			IdleConnTimeout:     0,
-			MaxIdleConns:        200,
-			MaxIdleConnsPerHost: 100}
-	} else {
-		tr = &http.Transport{
-			DisableKeepAlives:   false,
-			IdleConnTimeout:     0,
-			MaxIdleConns:        200,
-			MaxIdleConnsPerHost: 100,
-			TLSClientConfig:     &tls.Config{InsecureSkipVerify: true},
+	proxmox.Username = o.username
+	if !strings.Contains(proxmox.Username, "@") {
+		proxmox.Username = proxmox.Username + "@" + o.realm
+	}
+	proxmox.password = o.password
+	proxmox.session = new(session)
+	if proxmox.Client.Jar == nil {
+		proxmox.Client.Jar, err = cookiejar.New(nil)
+		if err != nil {
+			return nil, err
 		}
 	}
-	proxmox.Client = &http.Client{
-		Transport: tr,
-		Timeout:   time.Second * 10}
-	form = url.Values{
-		"username": {proxmox.Username},
-		"password": {proxmox.password},
+
+	err = proxmox.login(ctx, proxmox.password)
+	if err != nil && canFailover("POST", err) && proxmox.failover(ctx, proxmox.hostname()) {
+		err = nil
+	}
+	if err != nil {
+		return nil, err
 	}
+	proxmox.ConnectionTicket = proxmox.Ticket()
+	return proxmox, nil
+}
 
-	data, err = proxmox.PostForm("access/ticket", form)
+func newProxMox(HostName string, o *options) (*ProxMox, error) {
+	var proxmox *ProxMox
+	var tr *http.Transport
+	var tlsConfig *tls.Config
+	var host string
+	var err error
+
+	host, err = normalizeHost(HostName, o.port)
 	if err != nil {
 		return nil, err
-	} else {
-		proxmox.ConnectionTicket = data["ticket"].(string)
-		proxmox.connectionCSRFPreventionToken = data["CSRFPreventionToken"].(string)
-		proxmox.Client.Jar, err = cookiejar.New(nil)
-		domain = proxmox.Hostname
+	}
 
-		cookie := &http.Cookie{
-			Name:  "PVEAuthCookie",
-			Value: data["ticket"].(string),
-			Path:  "/",
+	proxmox = new(ProxMox)
+	proxmox.Hostname = host
+	proxmox.BaseURL = proxmox.Hostname + "/api2/json/"
+	proxmox.userAgent = o.userAgent
+	proxmox.Logger = o.logger
+	proxmox.retry = o.retry
+	if len(o.failover) > 0 {
+		if o.tls.Fingerprint != "" {
+			return nil, errors.New("A certificate fingerprint cannot be used with failover, every node has its own certificate. Use the cluster CA /etc/pve/pve-root-ca.pem as CACert instead.")
 		}
-		cookies = append(cookies, cookie)
-		cookieURL, err := url.Parse(domain + "/")
+		proxmox.endpoints = &endpoints{hosts: []string{host}}
+		for _, HostName = range o.failover {
+			host, err = normalizeHost(HostName, o.port)
+			if err != nil {
+				return nil, err
+			}
+			proxmox.endpoints.hosts = append(proxmox.endpoints.hosts, host)
+		}
+	}
+
+	if o.client != nil {
+		// Work on a copy with its own cookie jar, the login ticket must
+		// not leak into a client the caller uses elsewhere.
+		client := *o.client
+		client.Jar, err = cookiejar.New(nil)
 		if err != nil {
 			return nil, err
 		}
-		proxmox.Client.Jar.SetCookies(cookieURL, cookies)
-
+		proxmox.Client = &client
+		return proxmox, nil
+	}
+	proxmox.Client = &http.Client{
+		Transport: o.transport,
+		Timeout:   o.timeout}
+	if o.transport != nil {
 		return proxmox, nil
 	}
+
+	tlsConfig, err = o.tls.config()
+	if err != nil {
+		return nil, err
+	}
+	proxmox.VerifySSL = o.tls.verify()
+	tr = &http.Transport{
+		DisableKeepAlives:   false,
+		IdleConnTimeout:     0,
+		MaxIdleConns:        200,
+		MaxIdleConnsPerHost: 100,
+		TLSClientConfig:     tlsConfig,
+	}
+	if o.proxy != nil {
+		tr.Proxy = http.ProxyURL(o.proxy)
+	}
+	proxmox.Client.Transport = tr
+	return proxmox, nil
+}
+
+// authorize adds either the API token or the CSRF prevention token belonging
+// to the login ticket to a request.
+func (proxmox ProxMox) authorize(req *http.Request) {
+	if proxmox.apiToken != "" {
+		req.Header.Set("Authorization", "PVEAPIToken="+proxmox.apiToken)
+		return
+	}
+	if req.Method == "GET" || proxmox.session == nil {
+		return
+	}
+	if _, csrf, _ := proxmox.session.get(); csrf != "" {
+		req.Header.Add("CSRFPreventionToken", csrf)
+	}
 }
 
 func (proxmox ProxMox) Nodes() (NodeList, error) {
+	return proxmox.NodesCtx(context.Background())
+}
+
+// NodesCtx returns the nodes which are up. Use AllNodesCtx to include
+// offline nodes.
+func (proxmox ProxMox) NodesCtx(ctx context.Context) (NodeList, error) {
+	return proxmox.nodes(ctx, false)
+}
+
+func (proxmox ProxMox) AllNodes() (NodeList, error) {
+	return proxmox.AllNodesCtx(context.Background())
+}
+
+// AllNodesCtx returns all cluster members. Check Status for "online",
+// "offline" or "unknown", the usage figures of nodes which are down are 0.
+func (proxmox ProxMox) AllNodesCtx(ctx context.Context) (NodeList, error) {
+	return proxmox.nodes(ctx, true)
+}
+
+func (proxmox ProxMox) nodes(ctx context.Context, offline bool) (NodeList, error) {
 	var err error
-	var data map[string]interface{}
+	var results []nodeData
 	var list NodeList
 	var node Node
-	var results []interface{}
 
 	//fmt.Println("!Nodes")
 
-	data, err = proxmox.Get("nodes")
+	err = proxmox.Do(ctx, "GET", "nodes", nil, &results)
 	if err != nil {
 		return nil, err
 	}
 	list = make(NodeList)
-	results = data["data"].([]interface{})
-	for _, v0 := range results {
-		v := v0.(map[string]interface{})
-		if val, ok := v["uptime"]; !ok || val == nil {
-			fmt.Println("Node probably down. Skipping.")
+	for _, v := range results {
+		if v.Uptime == nil && !offline {
+			proxmox.log().WarnContext(ctx, "Node probably down. Skipping.", "node", v.Node)
 			continue
 		}
-		node = Node{
-			Mem:      v["mem"].(float64),
-			MaxDisk:  v["maxdisk"].(float64),
-			Node:     v["node"].(string),
-			MaxCPU:   v["maxcpu"].(float64),
-			Uptime:   v["uptime"].(float64),
-			Id:       v["id"].(string),
-			CPU:      v["cpu"].(float64),
-			Level:    v["level"].(string),
-			NodeType: v["type"].(string),
-			Disk:     v["disk"].(float64),
-			MaxMem:   v["maxmem"].(float64),
-			Proxmox:  proxmox,
+		node = v.node(proxmox)
+		if node.Status == "" {
+			node.Status = "online"
+			if v.Uptime == nil {
+				node.Status = "offline"
+			}
 		}
 		list[node.Node] = node
 	}
@@ -144,148 +273,64 @@ func (proxmox ProxMox) Nodes() (NodeList, error) {
 }
 
 func (proxmox ProxMox) NextVMId() (string, error) {
-	data, err := proxmox.Get("cluster/nextid")
-	if err != nil {
-		return "", err
-	}
-
-	result := data["data"].(string)
-	return result, nil
+	return proxmox.NextVMIdCtx(context.Background())
 }
 
-func (proxmox ProxMox) DetermineVMPlacement(cpu int64, cores int64, mem int64, overCommitCPU float64, overCommitMem float64) (Node, error) {
-	var nodeList NodeList
-	var node Node
-	var qemuList []QemuVM
-	var qemu QemuVM
-	var errNode Node
-	var usedCPUs int64
-	var usedMem int64
+func (proxmox ProxMox) NextVMIdCtx(ctx context.Context) (string, error) {
+	return nextVMId(ctx, proxmox)
+}
 
-	var err error
+func nextVMId(ctx context.Context, api Requester) (string, error) {
+	var result flexString
 
-	nodeList, err = proxmox.Nodes()
+	err := api.Do(ctx, "GET", "cluster/nextid", nil, &result)
 	if err != nil {
-		return errNode, errors.New("Could not get any nodes.")
-	}
-	for _, node = range nodeList {
-		qemuListSorted, err := node.Qemu()
-		if err != nil {
-			return errNode, errors.New("Could not get VMs for node " + node.Node + ".")
-		}
-		//Randomize order of nodes
-		qemuList = make([]QemuVM, len(qemuListSorted))
-		perm := rand.Perm(len(qemuListSorted))
-		i := 0
-		for s := range qemuListSorted {
-			qemuList[perm[i]] = qemuListSorted[s]
-			i++
-		}
-		for _, qemu = range qemuList {
-			usedCPUs = usedCPUs + int64(qemu.CPUs)
-			usedMem = usedMem + int64(qemu.MaxMem)
-		}
-		if (cpu*cores < int64(node.MaxCPU*(1+overCommitCPU))-usedCPUs) && (mem < int64(node.MaxMem*(1+overCommitMem))-usedMem) {
-			return node, nil
-			//		} else {
-			//			fmt.Printf("CPU: %v < %v, Memory: %v < %v\n", cpu*cores, int64(node.MaxCPU*(1+overCommitCPU))-usedCPUs, mem, int64(node.MaxMem*(1+overCommitMem))-usedMem)
-		}
+		return "", err
 	}
-	return errNode, errors.New("Not enough free capacity on any of the nodes.")
+	return string(result), nil
 }
 
 func (proxmox ProxMox) FindVM(VmId string) (QemuVM, error) {
-	var nodeList NodeList
-	var node Node
-	var qemuList QemuList
+	return proxmox.FindVMCtx(context.Background(), VmId)
+}
+
+// FindVMCtx looks the VM up in the cluster resources. The Node of the VM
+// returned only carries the node name. IsNotFound reports a missing VM.
+func (proxmox ProxMox) FindVMCtx(ctx context.Context, VmId string) (QemuVM, error) {
+	var resources Resources
 	var qemu QemuVM
 	var errQemu QemuVM
 	var ok bool
 	var err error
 
-	nodeList, err = proxmox.Nodes()
+	resources, err = proxmox.ResourcesCtx(ctx, ResourceVM)
 	if err != nil {
-		return errQemu, errors.New("Could not get any nodes.")
+		return errQemu, fmt.Errorf("Could not get cluster resources: %w", err)
 	}
-	for _, node = range nodeList {
-		qemuList, err = node.Qemu()
-		if err != nil {
-			return errQemu, errors.New("Could not get VMs for node " + node.Node + ".")
-		}
-		if qemu, ok = qemuList[VmId]; ok {
-			return qemu, nil
-		}
+	if qemu, ok = resources.VMs[VmId]; ok {
+		return qemu, nil
 	}
-	return errQemu, errors.New("VM " + VmId + " not found.")
+	return errQemu, fmt.Errorf("VM %s: %w", VmId, ErrNotFound)
 }
 
 func (proxmox ProxMox) Tasks() (TaskList, error) {
+	return proxmox.TasksCtx(context.Background())
+}
+
+func (proxmox ProxMox) TasksCtx(ctx context.Context) (TaskList, error) {
 	var err error
-	var target string
-	var data map[string]interface{}
+	var results []taskData
 	var list TaskList
 	var task Task
-	var results []interface{}
 
 	//fmt.Println("!Tasks")
-	target = "cluster/tasks"
-	data, err = proxmox.Get(target)
+	err = proxmox.Do(ctx, "GET", "cluster/tasks", nil, &results)
 	if err != nil {
 		return nil, err
 	}
 	list = make(TaskList)
-	results = data["data"].([]interface{})
-	for _, v0 := range results {
-		v := v0.(map[string]interface{})
-		task = Task{
-			UPid:    v["upid"].(string),
-			Type:    v["type"].(string),
-			ID:      v["id"].(string),
-			proxmox: proxmox,
-		}
-		switch v["status"].(type) {
-		default:
-			task.Status = ""
-		case string:
-			task.Status = v["status"].(string)
-		}
-		switch v["exitstatus"].(type) {
-		default:
-			task.ExitStatus = ""
-		case string:
-			task.ExitStatus = v["exitstatus"].(string)
-		}
-		switch v["pstart"].(type) {
-		default:
-			task.PStart = 0
-		case float64:
-			task.PStart = v["pstart"].(float64)
-		}
-		switch v["starttime"].(type) {
-		default:
-			task.StartTime = 0
-		case float64:
-			task.StartTime = v["starttime"].(float64)
-		case string:
-			s := v["starttime"].(string)
-			task.StartTime, err = strconv.ParseFloat(s, 64)
-		}
-		switch v["endtime"].(type) {
-		default:
-			task.EndTime = 0
-		case float64:
-			task.EndTime = v["endtime"].(float64)
-		case string:
-			s := v["endtime"].(string)
-			task.EndTime, err = strconv.ParseFloat(s, 64)
-		}
-		switch v["pid"].(type) {
-		default:
-			task.PID = 0
-		case float64:
-			task.PID = v["pid"].(float64)
-		}
-
+	for _, v := range results {
+		task = v.task(proxmox)
 		list[task.UPid] = task
 	}
 
@@ -293,28 +338,22 @@ func (proxmox ProxMox) Tasks() (TaskList, error) {
 }
 
 func (proxmox ProxMox) Pools() (PoolList, error) {
+	return proxmox.PoolsCtx(context.Background())
+}
+
+func (proxmox ProxMox) PoolsCtx(ctx context.Context) (PoolList, error) {
 	var err error
-	var target string
-	var data map[string]interface{}
+	var results []Pool
 	var list PoolList
-	var pool Pool
-	var results []interface{}
 
-	//fmt.Println("!Tasks")
-	target = "pools"
-	data, err = proxmox.Get(target)
+	//fmt.Println("!Pools")
+	err = proxmox.Do(ctx, "GET", "pools", nil, &results)
 	if err != nil {
 		return nil, err
 	}
 	list = make(PoolList)
-	results = data["data"].([]interface{})
-	for _, v0 := range results {
-		v := v0.(map[string]interface{})
-		pool = Pool{
-			Poolid:  v["poolid"].(string),
-			proxmox: proxmox,
-		}
-
+	for _, pool := range results {
+		pool.proxmox = proxmox
 		list[pool.Poolid] = pool
 	}
 
@@ -322,218 +361,111 @@ func (proxmox ProxMox) Pools() (PoolList, error) {
 }
 
 func (proxmox ProxMox) NewPool(name string, comment string) (map[string]interface{}, error) {
+	return proxmox.NewPoolCtx(context.Background(), name, comment)
+}
+
+func (proxmox ProxMox) NewPoolCtx(ctx context.Context, name string, comment string) (map[string]interface{}, error) {
 	poolForm := url.Values{}
 	poolForm.Set("poolid", name)
 	poolForm.Set("comment", comment)
 
-	result, err := proxmox.PostForm("pools", poolForm)
+	result, err := proxmox.PostFormCtx(ctx, "pools", poolForm)
 	if err != nil {
-		fmt.Println("Error while posting form")
-		fmt.Println(err)
+		proxmox.log().DebugContext(ctx, "Error while posting form", "error", err)
 		return result, err
 	}
 
-	fmt.Printf("Result: %s", result)
+	proxmox.log().DebugContext(ctx, "Pool saved", "pool", name, "result", result)
 
 	return result, nil
 }
 
 func (proxmox ProxMox) UpdatePool(name string, comment string) (map[string]interface{}, error) {
+	return proxmox.UpdatePoolCtx(context.Background(), name, comment)
+}
+
+func (proxmox ProxMox) UpdatePoolCtx(ctx context.Context, name string, comment string) (map[string]interface{}, error) {
 	poolForm := url.Values{}
 	poolForm.Set("poolid", name)
 	poolForm.Set("comment", comment)
 
-	result, err := proxmox.PutForm("pools/"+name, poolForm)
+	result, err := proxmox.PutFormCtx(ctx, "pools/"+name, poolForm)
 	if err != nil {
-		fmt.Println("Error while posting form")
-		fmt.Println(err)
+		proxmox.log().DebugContext(ctx, "Error while posting form", "error", err)
 		return result, err
 	}
 
-	fmt.Printf("Result: %s", result)
+	proxmox.log().DebugContext(ctx, "Pool saved", "pool", name, "result", result)
 
 	return result, nil
 }
 
 func (proxmox ProxMox) DeletePool(name string) error {
-	result, err := proxmox.Delete(fmt.Sprintf("pools/%s", name))
+	return proxmox.DeletePoolCtx(context.Background(), name)
+}
+
+func (proxmox ProxMox) DeletePoolCtx(ctx context.Context, name string) error {
+	result, err := proxmox.DeleteCtx(ctx, fmt.Sprintf("pools/%s", name))
 
 	if err != nil {
-		fmt.Printf("Error deleting pool: %s", name)
-		fmt.Println(err)
-		fmt.Printf("Result was: %s", result)
+		proxmox.log().DebugContext(ctx, "Error deleting pool", "pool", name, "error", err, "result", result)
+		return err
 	}
 
-	fmt.Printf("Created pool: %s\n", name)
+	proxmox.log().DebugContext(ctx, "Deleted pool", "pool", name)
 
 	return nil
 }
 
 func (proxmox ProxMox) PostForm(endpoint string, form url.Values) (map[string]interface{}, error) {
-	var target string
-	var data interface{}
-	var req *http.Request
+	return proxmox.PostFormCtx(context.Background(), endpoint, form)
+}
 
+func (proxmox ProxMox) PostFormCtx(ctx context.Context, endpoint string, form url.Values) (map[string]interface{}, error) {
 	//fmt.Println("!PostForm")
 
-	target = proxmox.BaseURL + endpoint
-	//target = "http://requestb.in/1ls8s9d1"
-	//fmt.Println("POST form " + target)
-
-	req, err := http.NewRequest("POST", target, bytes.NewBufferString(form.Encode()))
-
-	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
-	req.Header.Add("Content-Length", strconv.Itoa(len(form.Encode())))
-	if proxmox.connectionCSRFPreventionToken != "" {
-		req.Header.Add("CSRFPreventionToken", proxmox.connectionCSRFPreventionToken)
-	}
-
-	//fmt.Printf("Posting form values: %s\n", req)
-
-	r, err := proxmox.Client.Do(req)
-	if err != nil {
-		fmt.Println("Error while posting")
-		fmt.Println(err)
-		return nil, err
-	}
-	//fmt.Print("HTTP status ")
-	//fmt.Println(r.StatusCode)
-	if r.StatusCode != 200 {
-		return nil, errors.New("HTTP Error " + r.Status)
-		//	} else {
-	}
-
-	response, err := ioutil.ReadAll(r.Body)
-	r.Body.Close()
-	if err != nil {
-		fmt.Println("Error while reading body")
-		fmt.Println(err)
-		return nil, err
-	}
-	err = json.Unmarshal(response, &data)
+	response, err := proxmox.request(ctx, "POST", endpoint, form.Encode(), "application/x-www-form-urlencoded")
 	if err != nil {
-		fmt.Println("Error while processing JSON")
-		fmt.Println(err)
 		return nil, err
 	}
-	m := data.(map[string]interface{})
-	switch m["data"].(type) {
-	case map[string]interface{}:
-		d := m["data"].(map[string]interface{})
-		return d, nil
-	}
-	return m, nil
+	return proxmox.decodeMap(ctx, endpoint, response, true)
 }
 
 func (proxmox ProxMox) Post(endpoint string, input string) (map[string]interface{}, error) {
-	var target string
-	var data interface{}
-	var req *http.Request
+	return proxmox.PostCtx(context.Background(), endpoint, input)
+}
 
+func (proxmox ProxMox) PostCtx(ctx context.Context, endpoint string, input string) (map[string]interface{}, error) {
 	//fmt.Println("!Post")
 
-	target = proxmox.BaseURL + endpoint
-	//target = "http://requestb.in/1ls8s9d1"
-	//fmt.Println("POST form " + target)
-
-	req, err := http.NewRequest("POST", target, bytes.NewBufferString(input))
-
-	req.Header.Add("Content-Length", strconv.Itoa(len(input)))
-	if proxmox.connectionCSRFPreventionToken != "" {
-		req.Header.Add("CSRFPreventionToken", proxmox.connectionCSRFPreventionToken)
-	}
-	r, err := proxmox.Client.Do(req)
+	response, err := proxmox.request(ctx, "POST", endpoint, input, "")
 	if err != nil {
-		fmt.Println("Error while posting")
-		fmt.Println(err)
 		return nil, err
 	}
-	//fmt.Print("HTTP status ")
-	//fmt.Println(r.StatusCode)
-	if r.StatusCode != 200 {
-		return nil, errors.New("HTTP Error " + r.Status)
-		//	} else {
-	}
-
-	response, err := ioutil.ReadAll(r.Body)
-	r.Body.Close()
-	if err != nil {
-		fmt.Println("Error while reading body")
-		fmt.Println(err)
-		return nil, err
-	}
-	err = json.Unmarshal(response, &data)
-	if err != nil {
-		fmt.Println("Error while processing JSON")
-		fmt.Println(err)
-		return nil, err
-	}
-	m := data.(map[string]interface{})
-	switch m["data"].(type) {
-	case map[string]interface{}:
-		d := m["data"].(map[string]interface{})
-		return d, nil
-	}
-	return m, nil
+	return proxmox.decodeMap(ctx, endpoint, response, true)
 }
 
 func (proxmox ProxMox) PutForm(endpoint string, form url.Values) (map[string]interface{}, error) {
-	var target string
-	var data interface{}
-	var req *http.Request
+	return proxmox.PutFormCtx(context.Background(), endpoint, form)
+}
 
+func (proxmox ProxMox) PutFormCtx(ctx context.Context, endpoint string, form url.Values) (map[string]interface{}, error) {
 	//fmt.Println("!PutForm")
 
-	target = proxmox.BaseURL + endpoint
-
-	req, err := http.NewRequest("PUT", target, bytes.NewBufferString(form.Encode()))
-
-	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
-	req.Header.Add("Content-Length", strconv.Itoa(len(form.Encode())))
-	if proxmox.connectionCSRFPreventionToken != "" {
-		req.Header.Add("CSRFPreventionToken", proxmox.connectionCSRFPreventionToken)
-	}
-	r, err := proxmox.Client.Do(req)
-	defer r.Body.Close()
-	if err != nil {
-		fmt.Println("Error while puting")
-		fmt.Println(err)
-		return nil, err
-	}
-	//fmt.Print("HTTP status ")
-	//fmt.Println(r.StatusCode)
-	if r.StatusCode != 200 {
-		//spew.Dump(r)
-		return nil, errors.New("HTTP Error " + r.Status)
-		//	} else {
-		//		spew.Dump(r)
-	}
-
-	response, err := ioutil.ReadAll(r.Body)
-	if err != nil {
-		fmt.Println("Error while reading body")
-		fmt.Println(err)
-		return nil, err
-	}
-	err = json.Unmarshal(response, &data)
+	response, err := proxmox.request(ctx, "PUT", endpoint, form.Encode(), "application/x-www-form-urlencoded")
 	if err != nil {
-		fmt.Println("Error while processing JSON")
-		fmt.Println(err)
 		return nil, err
 	}
-	m := data.(map[string]interface{})
-	//spew.Dump(m)
-	switch m["data"].(type) {
-	case map[string]interface{}:
-		d := m["data"].(map[string]interface{})
-		return d, nil
-	}
-	return m, nil
+	return proxmox.decodeMap(ctx, endpoint, response, true)
 }
 
+// GetRaw returns the response body regardless of the status code.
 func (proxmox ProxMox) GetRaw(endpoint string) ([]byte, error) {
-	target := proxmox.BaseURL + endpoint
-	r, err := proxmox.Client.Get(target)
+	return proxmox.GetRawCtx(context.Background(), endpoint)
+}
+
+func (proxmox ProxMox) GetRawCtx(ctx context.Context, endpoint string) ([]byte, error) {
+	r, err := proxmox.send(ctx, "GET", endpoint, "", "")
 	if err != nil {
 		return nil, err
 	}
@@ -547,97 +479,57 @@ func (proxmox ProxMox) GetRaw(endpoint string) ([]byte, error) {
 }
 
 func (proxmox ProxMox) Get(endpoint string) (map[string]interface{}, error) {
-	var target string
-	var data interface{}
+	return proxmox.GetCtx(context.Background(), endpoint)
+}
 
+func (proxmox ProxMox) GetCtx(ctx context.Context, endpoint string) (map[string]interface{}, error) {
 	//fmt.Println("!get")
 
-	target = proxmox.BaseURL + endpoint
-	//target = "http://requestb.in/1ls8s9d1"
-	//fmt.Println("GET " + target)
-	r, err := proxmox.Client.Get(target)
+	response, err := proxmox.request(ctx, "GET", endpoint, "", "")
 	if err != nil {
 		return nil, err
 	}
-	response, err := ioutil.ReadAll(r.Body)
-	r.Body.Close()
-	if err != nil {
-		return nil, err
-	}
-	err = json.Unmarshal(response, &data)
-	if err != nil {
-		return nil, err
-	}
-	m := data.(map[string]interface{})
-	//d := m["data"].(map[string]interface{})
-	return m, nil
+	return proxmox.decodeMap(ctx, endpoint, response, false)
 }
 
 func (proxmox ProxMox) GetBytes(endpoint string) ([]byte, error) {
-	var target string
+	return proxmox.GetBytesCtx(context.Background(), endpoint)
+}
 
+func (proxmox ProxMox) GetBytesCtx(ctx context.Context, endpoint string) ([]byte, error) {
 	//fmt.Println("!getBytes")
 
-	target = proxmox.BaseURL + endpoint
-	//target = "http://requestb.in/1ls8s9d1"
-	//fmt.Println("GET " + target)
-	r, err := proxmox.Client.Get(target)
-	if err != nil {
-		return nil, err
-	}
-	response, err := ioutil.ReadAll(r.Body)
-	r.Body.Close()
-	if err != nil {
-		return nil, err
-	}
-	return response, nil
+	return proxmox.request(ctx, "GET", endpoint, "", "")
 }
 
 func (proxmox ProxMox) Delete(endpoint string) (map[string]interface{}, error) {
-	var target string
-	var data interface{}
-	var req *http.Request
-
-	//fmt.Println("!PostForm")
-
-	target = proxmox.BaseURL + endpoint
-	//target = "http://requestb.in/1ls8s9d1"
-	//fmt.Println("DELETE " + target)
-
-	req, err := http.NewRequest("DELETE", target, nil)
+	return proxmox.DeleteCtx(context.Background(), endpoint)
+}
 
-	req.Header.Add("CSRFPreventionToken", proxmox.connectionCSRFPreventionToken)
+func (proxmox ProxMox) DeleteCtx(ctx context.Context, endpoint string) (map[string]interface{}, error) {
+	//fmt.Println("!Delete")
 
-	r, err := proxmox.Client.Do(req)
+	response, err := proxmox.request(ctx, "DELETE", endpoint, "", "")
 	if err != nil {
-		fmt.Println("Error while deleting")
-		fmt.Println(err)
 		return nil, err
 	}
-	//fmt.Print("HTTP status ")
-	//fmt.Println(r.StatusCode)
-	if r.StatusCode != 200 {
-		return nil, errors.New("HTTP Error " + r.Status)
-		//	} else {
-	}
+	return proxmox.decodeMap(ctx, endpoint, response, true)
+}
 
-	response, err := ioutil.ReadAll(r.Body)
-	r.Body.Close()
+// decodeMap decodes a response into a map. If unwrap is set and the data
+// member is an object, that object is returned instead of the whole response.
+func (proxmox ProxMox) decodeMap(ctx context.Context, endpoint string, response []byte, unwrap bool) (map[string]interface{}, error) {
+	var m map[string]interface{}
+
+	err := json.Unmarshal(response, &m)
 	if err != nil {
-		fmt.Println("Error while reading body")
-		fmt.Println(err)
+		proxmox.log().DebugContext(ctx, "Error while processing JSON", "endpoint", endpoint, "error", err)
 		return nil, err
 	}
-	err = json.Unmarshal(response, &data)
-	if err != nil {
-		fmt.Println("Error while processing JSON")
-		fmt.Println(err)
-		return nil, err
+	if m == nil {
+		m = make(map[string]interface{})
 	}
-	m := data.(map[string]interface{})
-	switch m["data"].(type) {
-	case map[string]interface{}:
-		d := m["data"].(map[string]interface{})
+	if d, ok := m["data"].(map[string]interface{}); ok && unwrap {
 		return d, nil
 	}
 	return m, nil
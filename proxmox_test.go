@@ -0,0 +1,288 @@
+package proxmox
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/joernott/go-proxmox/proxmoxtest"
+)
+
+const (
+	stubUser     = "root@pam"
+	stubPassword = "secret"
+	stubTokenID  = "root@pam!ci"
+	stubSecret   = "3f1c9a5e"
+)
+
+// stubServer is a minimal Proxmox API for testing the client itself. It
+// handles logins, checks tickets, CSRF prevention tokens and API tokens, and
+// answers other requests with the handler registered for "METHOD endpoint".
+type stubServer struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	tickets  map[string]string
+	issued   int
+	handlers map[string]http.HandlerFunc
+}
+
+func newStubServer(t *testing.T) *stubServer {
+	t.Helper()
+	s := &stubServer{tickets: make(map[string]string), handlers: make(map[string]http.HandlerFunc)}
+	s.Server = httptest.NewTLSServer(http.HandlerFunc(s.serve))
+	t.Cleanup(s.Close)
+	s.handleData("GET version", `{"version":"8.1.4","release":"8.1"}`)
+	s.handleData("GET nodes", `[{"node":"pve","id":"node/pve","type":"node","status":"online","level":"",
+		"uptime":3600,"cpu":0.01,"maxcpu":8,"mem":1073741824,"maxmem":17179869184,"disk":1073741824,"maxdisk":107374182400}]`)
+	return s
+}
+
+// handle registers handler for route, e.g. "GET nodes/pve/qemu".
+func (s *stubServer) handle(route string, handler http.HandlerFunc) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.handlers[route] = handler
+}
+
+// handleData answers route with data as data member.
+func (s *stubServer) handleData(route string, data string) {
+	s.handle(route, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"data":%s}`, data)
+	})
+}
+
+// expireTickets invalidates all tickets issued so far.
+func (s *stubServer) expireTickets() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tickets = make(map[string]string)
+}
+
+func (s *stubServer) serve(w http.ResponseWriter, r *http.Request) {
+	endpoint := strings.TrimPrefix(r.URL.Path, "/api2/json/")
+	if r.Method == "POST" && endpoint == "access/ticket" {
+		s.login(w, r)
+		return
+	}
+	if !s.authorized(r) {
+		http.Error(w, "authentication failure", http.StatusUnauthorized)
+		return
+	}
+	s.mu.Lock()
+	handler, ok := s.handlers[r.Method+" "+endpoint]
+	s.mu.Unlock()
+	if !ok {
+		http.Error(w, "Method '"+r.Method+" /"+endpoint+"' not implemented", http.StatusNotImplemented)
+		return
+	}
+	handler(w, r)
+}
+
+// login accepts the password of stubUser or a valid ticket as password.
+func (s *stubServer) login(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	password := r.PostFormValue("password")
+	if r.PostFormValue("username") != stubUser || (password != stubPassword && s.tickets[password] == "") {
+		http.Error(w, "authentication failure", http.StatusUnauthorized)
+		return
+	}
+	s.issued++
+	ticket := fmt.Sprintf("PVE:%s:%08X", stubUser, s.issued)
+	s.tickets[ticket] = fmt.Sprintf("CSRF:%08X", s.issued)
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprintf(w, `{"data":{"username":%q,"ticket":%q,"CSRFPreventionToken":%q}}`, stubUser, ticket, s.tickets[ticket])
+}
+
+func (s *stubServer) authorized(r *http.Request) bool {
+	if r.Header.Get("Authorization") == "PVEAPIToken="+stubTokenID+"="+stubSecret {
+		return true
+	}
+	cookie, err := r.Cookie("PVEAuthCookie")
+	if err != nil {
+		return false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	csrf, ok := s.tickets[cookie.Value]
+	return ok && (r.Method == "GET" || r.Header.Get("CSRFPreventionToken") == csrf)
+}
+
+// newStubClient logs in to s as stubUser.
+func newStubClient(t *testing.T, s *stubServer) *ProxMox {
+	t.Helper()
+	proxmox, err := NewProxMox(s.URL, stubUser, stubPassword)
+	if err != nil {
+		t.Fatalf("NewProxMox: %v", err)
+	}
+	return proxmox
+}
+
+func newTestServer(t *testing.T) *proxmoxtest.Server {
+	t.Helper()
+	srv := proxmoxtest.NewServer()
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// newTestClient logs in to the fake srv as proxmoxtest.DefaultUser, trusting
+// its certificate by fingerprint.
+func newTestClient(t *testing.T, srv *proxmoxtest.Server, opts ...Option) *ProxMox {
+	t.Helper()
+	opts = append([]Option{
+		WithPassword(proxmoxtest.DefaultUser, proxmoxtest.DefaultPassword),
+		WithTLS(TLSOptions{Fingerprint: srv.Fingerprint()}),
+	}, opts...)
+	proxmox, err := New(srv.URL, opts...)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	return proxmox
+}
+
+func TestPasswordLogin(t *testing.T) {
+	s := newStubServer(t)
+	s.handleData("POST pools", `null`)
+
+	tests := []struct {
+		name     string
+		user     string
+		password string
+		wantErr  bool
+	}{
+		{name: "with realm", user: "root@pam", password: stubPassword},
+		{name: "default realm", user: "root", password: stubPassword},
+		{name: "wrong password", user: "root", password: "wrong", wantErr: true},
+		{name: "wrong realm", user: "root@pve", password: stubPassword, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			proxmox, err := NewProxMox(s.URL, tt.user, tt.password)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("NewProxMox: got no error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("NewProxMox: %v", err)
+			}
+			if proxmox.Username != stubUser {
+				t.Errorf("Username = %q, want %q", proxmox.Username, stubUser)
+			}
+			if proxmox.ConnectionTicket == "" {
+				t.Error("ConnectionTicket is empty")
+			}
+			if _, err = proxmox.Nodes(); err != nil {
+				t.Errorf("Nodes: %v", err)
+			}
+			// Writes need the CSRF prevention token.
+			if _, err = proxmox.NewPool("test", ""); err != nil {
+				t.Errorf("NewPool: %v", err)
+			}
+		})
+	}
+}
+
+func TestTokenLogin(t *testing.T) {
+	s := newStubServer(t)
+	s.handleData("POST pools", `null`)
+
+	tests := []struct {
+		name    string
+		tokenID string
+		secret  string
+		wantErr bool
+	}{
+		{name: "valid", tokenID: stubTokenID, secret: stubSecret},
+		{name: "default realm", tokenID: "root!ci", secret: stubSecret},
+		{name: "wrong secret", tokenID: stubTokenID, secret: "wrong", wantErr: true},
+		{name: "unknown token", tokenID: "root@pam!other", secret: stubSecret, wantErr: true},
+		{name: "no token name", tokenID: "root@pam", secret: stubSecret, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			proxmox, err := NewProxMoxWithToken(s.URL, tt.tokenID, tt.secret)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("NewProxMoxWithToken: got no error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("NewProxMoxWithToken: %v", err)
+			}
+			if proxmox.Username != stubUser {
+				t.Errorf("Username = %q, want %q", proxmox.Username, stubUser)
+			}
+			if proxmox.ConnectionTicket != "" {
+				t.Errorf("ConnectionTicket = %q, want none for token authentication", proxmox.ConnectionTicket)
+			}
+			if _, err = proxmox.Nodes(); err != nil {
+				t.Errorf("Nodes: %v", err)
+			}
+			// Token requests need no CSRF prevention token.
+			if _, err = proxmox.NewPool("test", ""); err != nil {
+				t.Errorf("NewPool: %v", err)
+			}
+		})
+	}
+}
+
+func TestFindVM(t *testing.T) {
+	srv := newTestServer(t)
+	srv.AddVM(proxmoxtest.VM{VMID: 100, Name: "web"})
+	proxmox := newTestClient(t, srv)
+
+	qemu, err := proxmox.FindVM("100")
+	if err != nil {
+		t.Fatalf("FindVM: %v", err)
+	}
+	if qemu.Name != "web" || qemu.Node.Node != proxmoxtest.DefaultNode {
+		t.Errorf("FindVM = %q on %q, want web on %s", qemu.Name, qemu.Node.Node, proxmoxtest.DefaultNode)
+	}
+
+	_, err = proxmox.FindVM("101")
+	if !IsNotFound(err) {
+		t.Errorf("FindVM of a missing VM: got %v, want an error matching ErrNotFound", err)
+	}
+
+	srv.ExpireTickets()
+	srv.AddUser(proxmoxtest.DefaultUser, "changed")
+	_, err = proxmox.FindVM("100")
+	if !IsUnauthorized(err) {
+		t.Errorf("FindVM without valid login: got %v, want an error matching ErrUnauthorized", err)
+	}
+}
+
+func TestWithHTTPClient(t *testing.T) {
+	s := newStubServer(t)
+	client := s.Client()
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		t.Fatalf("cookiejar.New: %v", err)
+	}
+	client.Jar = jar
+
+	proxmox, err := New(s.URL, WithPassword(stubUser, stubPassword), WithHTTPClient(client))
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if _, err = proxmox.Nodes(); err != nil {
+		t.Errorf("Nodes: %v", err)
+	}
+	if proxmox.Client == client || proxmox.Client.Jar == jar {
+		t.Error("the client or its cookie jar is shared with the caller")
+	}
+	u, _ := url.Parse(s.URL)
+	if cookies := jar.Cookies(u); len(cookies) != 0 {
+		t.Errorf("cookies in the jar of the caller = %v, want none", cookies)
+	}
+}
@@ -0,0 +1,248 @@
+package proxmoxtest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Redacted replaces passwords, tickets and CSRF tokens in fixture files.
+const Redacted = "REDACTED"
+
+// Interaction is a recorded request and its response. Endpoint is relative to
+// /api2/json/ and includes the query string.
+type Interaction struct {
+	Method       string `json:"method"`
+	Endpoint     string `json:"endpoint"`
+	RequestBody  string `json:"request_body,omitempty"`
+	StatusCode   int    `json:"status_code"`
+	Status       string `json:"status"`
+	ResponseBody string `json:"response_body"`
+}
+
+// MismatchError is returned in replay mode for a request that has no
+// recorded interaction left.
+type MismatchError struct {
+	Method   string
+	Endpoint string
+}
+
+func (e *MismatchError) Error() string {
+	return "proxmoxtest: unexpected request " + e.Method + " " + e.Endpoint + ", no recorded interaction left"
+}
+
+// Recorder is an http.RoundTripper which either records requests sent
+// through another RoundTripper or replays previously recorded ones. Pass it
+// to the client with proxmox.WithTransport.
+type Recorder struct {
+	mu           sync.Mutex
+	replay       bool
+	path         string
+	transport    http.RoundTripper
+	interactions []Interaction
+	used         []bool
+}
+
+// NewRecorder records all requests sent through transport. Call Save to
+// write them to path. If transport is nil, http.DefaultTransport is used.
+func NewRecorder(path string, transport http.RoundTripper) *Recorder {
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	return &Recorder{path: path, transport: transport}
+}
+
+// NewReplayer serves the interactions recorded in path. Each interaction is
+// used once; requests are matched by method and endpoint in recorded order.
+func NewReplayer(path string) (*Recorder, error) {
+	var interactions []Interaction
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(data, &interactions)
+	if err != nil {
+		return nil, err
+	}
+	return &Recorder{
+		replay:       true,
+		path:         path,
+		interactions: interactions,
+		used:         make([]bool, len(interactions)),
+	}, nil
+}
+
+func (rec *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	var err error
+
+	if req.Body != nil {
+		body, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	endpoint := endpointOf(req.URL)
+	if rec.replay {
+		return rec.serve(req, endpoint)
+	}
+
+	r, err := rec.transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	response, err := io.ReadAll(r.Body)
+	r.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	r.Body = io.NopCloser(bytes.NewReader(response))
+
+	rec.mu.Lock()
+	rec.interactions = append(rec.interactions, Interaction{
+		Method:       req.Method,
+		Endpoint:     endpoint,
+		RequestBody:  redactForm(string(body)),
+		StatusCode:   r.StatusCode,
+		Status:       r.Status,
+		ResponseBody: redactJSON(response),
+	})
+	rec.mu.Unlock()
+	return r, nil
+}
+
+func (rec *Recorder) serve(req *http.Request, endpoint string) (*http.Response, error) {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	for i, interaction := range rec.interactions {
+		if rec.used[i] || interaction.Method != req.Method || interaction.Endpoint != endpoint {
+			continue
+		}
+		rec.used[i] = true
+		return &http.Response{
+			Status:        interaction.Status,
+			StatusCode:    interaction.StatusCode,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        http.Header{"Content-Type": {"application/json;charset=UTF-8"}},
+			Body:          io.NopCloser(strings.NewReader(interaction.ResponseBody)),
+			ContentLength: int64(len(interaction.ResponseBody)),
+			Request:       req,
+		}, nil
+	}
+	return nil, &MismatchError{Method: req.Method, Endpoint: endpoint}
+}
+
+// Interactions returns the interactions recorded or loaded so far.
+func (rec *Recorder) Interactions() []Interaction {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	return append([]Interaction(nil), rec.interactions...)
+}
+
+// Unused returns the recorded interactions not requested during replay.
+func (rec *Recorder) Unused() []Interaction {
+	var result []Interaction
+
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	for i, interaction := range rec.interactions {
+		if rec.replay && !rec.used[i] {
+			result = append(result, interaction)
+		}
+	}
+	return result
+}
+
+// Save writes the recorded interactions to the fixture file.
+func (rec *Recorder) Save() error {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	if rec.replay {
+		return fmt.Errorf("proxmoxtest: %s was loaded for replay and is not saved", rec.path)
+	}
+	var data bytes.Buffer
+	encoder := json.NewEncoder(&data)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	err := encoder.Encode(rec.interactions)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(rec.path, data.Bytes(), 0644)
+}
+
+func endpointOf(u *url.URL) string {
+	endpoint := u.Path
+	if i := strings.Index(endpoint, "/api2/json/"); i >= 0 {
+		endpoint = endpoint[i+len("/api2/json/"):]
+	}
+	if u.RawQuery != "" {
+		endpoint = endpoint + "?" + u.RawQuery
+	}
+	return endpoint
+}
+
+var redactedKeys = map[string]bool{
+	"password":            true,
+	"ticket":              true,
+	"CSRFPreventionToken": true,
+	"cipassword":          true,
+}
+
+func redactForm(body string) string {
+	if body == "" {
+		return ""
+	}
+	form, err := url.ParseQuery(body)
+	if err != nil {
+		return body
+	}
+	for k := range form {
+		if redactedKeys[k] {
+			form.Set(k, Redacted)
+		}
+	}
+	return form.Encode()
+}
+
+func redactJSON(body []byte) string {
+	var data interface{}
+
+	if json.Unmarshal(body, &data) != nil {
+		return string(body)
+	}
+	redactValue(data)
+	result, err := json.Marshal(data)
+	if err != nil {
+		return string(body)
+	}
+	return string(result)
+}
+
+func redactValue(v interface{}) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, item := range v {
+			if _, ok := item.(string); ok && redactedKeys[k] {
+				v[k] = Redacted
+				continue
+			}
+			redactValue(item)
+		}
+	case []interface{}:
+		for _, item := range v {
+			redactValue(item)
+		}
+	}
+}
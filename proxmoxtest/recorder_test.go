@@ -0,0 +1,85 @@
+package proxmoxtest_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/joernott/go-proxmox"
+	"github.com/joernott/go-proxmox/proxmoxtest"
+)
+
+func TestRecordAndReplay(t *testing.T) {
+	srv := proxmoxtest.NewServer()
+	defer srv.Close()
+	srv.AddVM(proxmoxtest.VM{VMID: 100, Name: "web", Status: "running"})
+	path := filepath.Join(t.TempDir(), "fixture.json")
+
+	recorder := proxmoxtest.NewRecorder(path, srv.Client().Transport)
+	client, err := proxmox.New(srv.URL,
+		proxmox.WithPassword(proxmoxtest.DefaultUser, proxmoxtest.DefaultPassword),
+		proxmox.WithTransport(recorder))
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	recorded, err := client.FindVM("100")
+	if err != nil {
+		t.Fatalf("FindVM: %v", err)
+	}
+	if err = recorder.Save(); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	if strings.Contains(string(data), proxmoxtest.DefaultPassword) || strings.Contains(string(data), client.Ticket()) {
+		t.Error("fixture contains the password or the ticket")
+	}
+
+	// Replay without the server.
+	srv.Close()
+	replayer, err := proxmoxtest.NewReplayer(path)
+	if err != nil {
+		t.Fatalf("NewReplayer: %v", err)
+	}
+	client, err = proxmox.New(srv.URL,
+		proxmox.WithPassword(proxmoxtest.DefaultUser, proxmoxtest.DefaultPassword),
+		proxmox.WithTransport(replayer))
+	if err != nil {
+		t.Fatalf("New with replayer: %v", err)
+	}
+	replayed, err := client.FindVM("100")
+	if err != nil {
+		t.Fatalf("FindVM with replayer: %v", err)
+	}
+	if replayed.Name != recorded.Name || replayed.Status != recorded.Status || replayed.Node.Node != recorded.Node.Node {
+		t.Errorf("replayed VM %+v, recorded %+v", replayed, recorded)
+	}
+	if unused := replayer.Unused(); len(unused) != 0 {
+		t.Errorf("Unused() = %v, want none", unused)
+	}
+
+	// Every interaction is used once.
+	_, err = client.Nodes()
+	var mismatch *proxmoxtest.MismatchError
+	if !errors.As(err, &mismatch) {
+		t.Fatalf("Nodes again: got %v, want a MismatchError", err)
+	}
+	if mismatch.Method != "GET" || mismatch.Endpoint != "nodes" {
+		t.Errorf("MismatchError = %s %s", mismatch.Method, mismatch.Endpoint)
+	}
+	if err = replayer.Save(); err == nil {
+		t.Error("Save of a replayer: got no error")
+	}
+}
+
+func TestReplayerMissingFile(t *testing.T) {
+	_, err := proxmoxtest.NewReplayer(filepath.Join(t.TempDir(), "missing.json"))
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("NewReplayer: got %v, want os.ErrNotExist", err)
+	}
+}
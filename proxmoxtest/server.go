@@ -0,0 +1,1545 @@
+// Package proxmoxtest provides an in-process fake of the Proxmox VE API for
+// hermetic tests. It keeps nodes, guests, storages, pools and tasks in memory
+// and implements the subset of the API used by package proxmox.
+package proxmoxtest
+
+import (
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultNode     = "pve"
+	DefaultUser     = "root@pam"
+	DefaultPassword = "secret"
+)
+
+// Server is a fake Proxmox API served over TLS. Use URL as host name for the
+// client and make it accept the self-signed certificate, e.g. by passing the
+// fingerprint returned by Fingerprint.
+type Server struct {
+	*httptest.Server
+
+	// TaskDuration is how long a task reports "running" before it stops.
+	// Effects of a task, e.g. a started VM, are applied immediately.
+	TaskDuration time.Duration
+
+	// Exec is called for commands run through the guest agent. By default
+	// commands exit with 0 and print their arguments.
+	Exec func(vm VM, command []string, input string) (exitCode int, stdout string, stderr string)
+
+	// ExecDuration is how long a command run through the guest agent
+	// reports not to have exited.
+	ExecDuration time.Duration
+
+	mu        sync.Mutex
+	users     map[string]string
+	tokens    map[string]string
+	tickets   map[string]string
+	csrf      map[string]string
+	nodes     map[string]*Node
+	vms       map[int]*VM
+	storages  map[string]*Storage
+	pools     map[string]*Pool
+	tasks     []*Task
+	taskCount int
+	execs     map[int]*execState
+}
+
+type execState struct {
+	status map[string]interface{}
+	end    time.Time
+}
+
+type Node struct {
+	Name   string
+	Online bool
+	MaxCPU int
+	MaxMem int64
+	Mem    int64
+	CPU    float64
+	Uptime int64
+}
+
+type VM struct {
+	VMID     int
+	Name     string
+	Node     string
+	Status   string
+	Paused   bool
+	Template bool
+	Pool     string
+	// Config holds the configuration as returned by .../config, the values
+	// are kept as strings.
+	Config map[string]string
+	// Files holds the files in the guest read and written through the guest
+	// agent, which is available while the VM runs with "agent: 1".
+	Files map[string]string
+	// Frozen is set while the guest filesystems are frozen.
+	Frozen bool
+	// Snapshots are keyed by name, Parent is the snapshot the current state
+	// is based on.
+	Snapshots map[string]*Snapshot
+	Parent    string
+}
+
+type Snapshot struct {
+	Name        string
+	Description string
+	Parent      string
+	SnapTime    int64
+	VMState     bool
+	Config      map[string]string
+}
+
+type Storage struct {
+	Name    string
+	Type    string
+	Content string
+	Shared  bool
+	Total   int64
+	Used    int64
+	// Volumes maps volume IDs to their size in bytes.
+	Volumes map[string]int64
+}
+
+type Pool struct {
+	PoolID  string
+	Comment string
+}
+
+type Task struct {
+	UPID       string
+	Node       string
+	Type       string
+	ID         string
+	User       string
+	ExitStatus string
+	Log        []string
+	start      time.Time
+	duration   time.Duration
+}
+
+// NewServer starts a fake with one online node named DefaultNode, a "local"
+// storage and the user DefaultUser with password DefaultPassword.
+func NewServer() *Server {
+	s := &Server{
+		users:    map[string]string{DefaultUser: DefaultPassword},
+		tokens:   make(map[string]string),
+		tickets:  make(map[string]string),
+		csrf:     make(map[string]string),
+		nodes:    make(map[string]*Node),
+		vms:      make(map[int]*VM),
+		storages: make(map[string]*Storage),
+		pools:    make(map[string]*Pool),
+		execs:    make(map[int]*execState),
+	}
+	s.AddNode(DefaultNode)
+	s.AddStorage(Storage{Name: "local", Type: "dir", Content: "images,iso,vztmpl,backup", Total: 100 << 30})
+	s.Server = httptest.NewTLSServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// Fingerprint returns the SHA-256 fingerprint of the server certificate in
+// the format shown by the Proxmox GUI.
+func (s *Server) Fingerprint() string {
+	var parts []string
+
+	sum := sha256.Sum256(s.Certificate().Raw)
+	for _, b := range sum {
+		parts = append(parts, strings.ToUpper(hex.EncodeToString([]byte{b})))
+	}
+	return strings.Join(parts, ":")
+}
+
+func (s *Server) AddUser(user string, password string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.users[user] = password
+}
+
+// AddToken adds an API token, tokenID has the form user@realm!tokenid.
+func (s *Server) AddToken(tokenID string, secret string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tokens[tokenID] = secret
+}
+
+// ExpireTickets invalidates all login tickets, so the next request using one
+// fails with 401.
+func (s *Server) ExpireTickets() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tickets = make(map[string]string)
+	s.csrf = make(map[string]string)
+}
+
+func (s *Server) AddNode(name string) *Node {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	node := &Node{Name: name, Online: true, MaxCPU: 8, MaxMem: 32 << 30, Uptime: 3600}
+	s.nodes[name] = node
+	return node
+}
+
+// SetNodeOnline marks a node as up or down. Down nodes are listed without
+// uptime and their guests cannot be reached.
+func (s *Server) SetNodeOnline(name string, online bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if node, ok := s.nodes[name]; ok {
+		node.Online = online
+	}
+}
+
+// AddStorage adds a storage available on all nodes.
+func (s *Server) AddStorage(storage Storage) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if storage.Volumes == nil {
+		storage.Volumes = make(map[string]int64)
+	}
+	s.storages[storage.Name] = &storage
+}
+
+// AddVM adds a guest. Node defaults to DefaultNode, Status to "stopped".
+func (s *Server) AddVM(vm VM) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if vm.Node == "" {
+		vm.Node = DefaultNode
+	}
+	if vm.Status == "" {
+		vm.Status = "stopped"
+	}
+	if vm.Config == nil {
+		vm.Config = make(map[string]string)
+	}
+	if vm.Files == nil {
+		vm.Files = make(map[string]string)
+	}
+	if vm.Snapshots == nil {
+		vm.Snapshots = make(map[string]*Snapshot)
+	}
+	if vm.Name != "" {
+		vm.Config["name"] = vm.Name
+	}
+	if _, ok := vm.Config["memory"]; !ok {
+		vm.Config["memory"] = "2048"
+	}
+	if _, ok := vm.Config["cores"]; !ok {
+		vm.Config["cores"] = "1"
+	}
+	if _, ok := vm.Config["sockets"]; !ok {
+		vm.Config["sockets"] = "1"
+	}
+	s.vms[vm.VMID] = &vm
+}
+
+// AddSnapshot adds a snapshot to a VM, e.g. to have one with a given
+// SnapTime. The parent defaults to the current one, which the new snapshot
+// becomes. Without Config, the current configuration is used.
+func (s *Server) AddSnapshot(vmid int, snapshot Snapshot) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	vm, ok := s.vms[vmid]
+	if !ok {
+		return
+	}
+	if vm.Snapshots == nil {
+		vm.Snapshots = make(map[string]*Snapshot)
+	}
+	if snapshot.Parent == "" {
+		snapshot.Parent = vm.Parent
+	}
+	if snapshot.SnapTime == 0 {
+		snapshot.SnapTime = time.Now().Unix()
+	}
+	if snapshot.Config == nil {
+		snapshot.Config = make(map[string]string)
+		for k, v := range vm.Config {
+			snapshot.Config[k] = v
+		}
+	}
+	vm.Snapshots[snapshot.Name] = &snapshot
+	vm.Parent = snapshot.Name
+}
+
+// VM returns a copy of the guest with the given ID.
+func (s *Server) VM(vmid int) (VM, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	vm, ok := s.vms[vmid]
+	if !ok {
+		return VM{}, false
+	}
+	result := *vm
+	result.Config = make(map[string]string)
+	for k, v := range vm.Config {
+		result.Config[k] = v
+	}
+	return result, true
+}
+
+// Tasks returns copies of all tasks started so far.
+func (s *Server) Tasks() []Task {
+	var result []Task
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, t := range s.tasks {
+		result = append(result, *t)
+	}
+	return result
+}
+
+func (s *Server) AddPool(pool Pool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pools[pool.PoolID] = &pool
+}
+
+// apiError is answered like pveproxy does it, with the message in the body
+// since net/http cannot set a custom reason phrase.
+type apiError struct {
+	status  int
+	message string
+	errors  map[string]string
+}
+
+func (e *apiError) Error() string {
+	return e.message
+}
+
+func errorf(status int, format string, args ...interface{}) *apiError {
+	return &apiError{status: status, message: fmt.Sprintf(format, args...)}
+}
+
+func paramError(param string, message string) *apiError {
+	return &apiError{status: http.StatusBadRequest, message: "Parameter verification failed.", errors: map[string]string{param: message}}
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	var data interface{}
+	var err *apiError
+
+	path := strings.TrimPrefix(r.URL.Path, "/api2/json/")
+	if path == r.URL.Path {
+		http.NotFound(w, r)
+		return
+	}
+	if parseErr := r.ParseForm(); parseErr != nil {
+		s.writeError(w, errorf(http.StatusBadRequest, "%s", parseErr.Error()))
+		return
+	}
+
+	s.mu.Lock()
+	if path == "access/ticket" && r.Method == "POST" {
+		data, err = s.login(r)
+	} else {
+		var user string
+		user, err = s.authenticate(r)
+		if err == nil {
+			data, err = s.route(r, strings.Split(strings.Trim(path, "/"), "/"), user)
+		}
+	}
+	s.mu.Unlock()
+
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json;charset=UTF-8")
+	json.NewEncoder(w).Encode(map[string]interface{}{"data": data})
+}
+
+func (s *Server) writeError(w http.ResponseWriter, err *apiError) {
+	body := map[string]interface{}{"data": nil, "message": err.message + "\n"}
+	if err.errors != nil {
+		body["errors"] = err.errors
+	}
+	w.Header().Set("Content-Type", "application/json;charset=UTF-8")
+	w.WriteHeader(err.status)
+	json.NewEncoder(w).Encode(body)
+}
+
+func randomString(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func (s *Server) login(r *http.Request) (interface{}, *apiError) {
+	user := r.PostForm.Get("username")
+	password := r.PostForm.Get("password")
+	if !strings.Contains(user, "@") {
+		user = user + "@pam"
+	}
+	valid := s.users[user] == password && password != ""
+	if !valid && s.tickets[password] == user {
+		valid = true
+	}
+	if !valid {
+		return nil, errorf(http.StatusUnauthorized, "authentication failure")
+	}
+	ticket := "PVE:" + user + ":" + strings.ToUpper(randomString(8)) + "::" + randomString(32)
+	csrf := strings.ToUpper(randomString(4)) + ":" + randomString(16)
+	s.tickets[ticket] = user
+	s.csrf[ticket] = csrf
+	return map[string]interface{}{
+		"ticket":              ticket,
+		"CSRFPreventionToken": csrf,
+		"username":            user,
+	}, nil
+}
+
+func (s *Server) authenticate(r *http.Request) (string, *apiError) {
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "PVEAPIToken=") {
+		token := strings.TrimPrefix(auth, "PVEAPIToken=")
+		i := strings.LastIndex(token, "=")
+		if i < 0 {
+			return "", errorf(http.StatusUnauthorized, "invalid token value")
+		}
+		if secret, ok := s.tokens[token[:i]]; ok && secret == token[i+1:] {
+			return token[:strings.Index(token, "!")], nil
+		}
+		return "", errorf(http.StatusUnauthorized, "invalid token value")
+	}
+	cookie, err := r.Cookie("PVEAuthCookie")
+	if err != nil {
+		return "", errorf(http.StatusUnauthorized, "no ticket")
+	}
+	user, ok := s.tickets[cookie.Value]
+	if !ok {
+		return "", errorf(http.StatusUnauthorized, "invalid ticket")
+	}
+	if r.Method != "GET" && r.Header.Get("CSRFPreventionToken") != s.csrf[cookie.Value] {
+		return "", errorf(http.StatusUnauthorized, "Permission denied - invalid csrf token")
+	}
+	return user, nil
+}
+
+// match reports whether path matches pattern, where "*" matches any segment.
+func match(path []string, pattern ...string) bool {
+	if len(path) != len(pattern) {
+		return false
+	}
+	for i, p := range pattern {
+		if p != "*" && p != path[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *Server) route(r *http.Request, path []string, user string) (interface{}, *apiError) {
+	switch {
+	case match(path, "version"):
+		return map[string]interface{}{"version": "8.2.4", "release": "8.2", "repoid": "faa83925c9641325"}, nil
+	case match(path, "nodes") && r.Method == "GET":
+		return s.listNodes(), nil
+	case match(path, "cluster", "nextid") && r.Method == "GET":
+		return strconv.Itoa(s.nextID()), nil
+	case match(path, "cluster", "status") && r.Method == "GET":
+		return s.clusterStatus(), nil
+	case match(path, "cluster", "resources") && r.Method == "GET":
+		return s.listResources(r.Form.Get("type")), nil
+	case match(path, "cluster", "tasks") && r.Method == "GET":
+		return s.listTasks("", r.Form), nil
+	case match(path, "storage") && r.Method == "GET":
+		return s.listStorages(""), nil
+	case match(path, "pools"):
+		return s.handlePools(r)
+	case match(path, "pools", "*"):
+		return s.handlePool(r, path[1])
+	case len(path) >= 2 && path[0] == "nodes":
+		node, ok := s.nodes[path[1]]
+		if !ok {
+			return nil, errorf(http.StatusInternalServerError, "hostname lookup '%s' failed - failed to get address info for: %s: Name or service not known", path[1], path[1])
+		}
+		if !node.Online {
+			return nil, errorf(595, "Connection refused")
+		}
+		return s.routeNode(r, node, path[2:], user)
+	}
+	return nil, errorf(http.StatusNotImplemented, "Method '%s /%s' not implemented", r.Method, strings.Join(path, "/"))
+}
+
+func (s *Server) routeNode(r *http.Request, node *Node, path []string, user string) (interface{}, *apiError) {
+	switch {
+	case match(path, "qemu") && r.Method == "GET":
+		return s.listVMs(node.Name), nil
+	case match(path, "qemu") && r.Method == "POST":
+		return s.createVM(r, node, user)
+	case match(path, "storage") && r.Method == "GET":
+		return s.listStorages(node.Name), nil
+	case match(path, "storage", "*", "content"):
+		return s.handleContent(r, node, path[1])
+	case match(path, "tasks") && r.Method == "GET":
+		return s.listTasks(node.Name, r.Form), nil
+	case match(path, "tasks", "*", "status") && r.Method == "GET":
+		return s.taskStatus(path[1])
+	case match(path, "tasks", "*", "log") && r.Method == "GET":
+		return s.taskLog(path[1], r.Form)
+	case match(path, "vzdump") && r.Method == "POST":
+		return s.startTask(node.Name, "vzdump", r.PostForm.Get("vmid"), user), nil
+	case len(path) >= 2 && path[0] == "qemu":
+		vmid, convErr := strconv.Atoi(path[1])
+		if convErr != nil {
+			return nil, paramError("vmid", "type check ('integer') failed - got '"+path[1]+"'")
+		}
+		vm, ok := s.vms[vmid]
+		if !ok || vm.Node != node.Name {
+			return nil, errorf(http.StatusInternalServerError, "Configuration file 'nodes/%s/qemu-server/%d.conf' does not exist", node.Name, vmid)
+		}
+		return s.routeVM(r, vm, path[2:], user)
+	}
+	return nil, errorf(http.StatusNotImplemented, "Method '%s /nodes/%s/%s' not implemented", r.Method, node.Name, strings.Join(path, "/"))
+}
+
+func (s *Server) routeVM(r *http.Request, vm *VM, path []string, user string) (interface{}, *apiError) {
+	id := strconv.Itoa(vm.VMID)
+	switch {
+	case match(path) && r.Method == "DELETE":
+		if vm.Status == "running" {
+			return nil, errorf(http.StatusInternalServerError, "VM %d is running - destroy failed", vm.VMID)
+		}
+		delete(s.vms, vm.VMID)
+		return s.startTask(vm.Node, "qmdestroy", id, user), nil
+	case match(path, "config") && r.Method == "GET":
+		return s.vmConfig(vm), nil
+	case match(path, "config") && (r.Method == "PUT" || r.Method == "POST"):
+		err := s.updateConfig(vm, r.PostForm)
+		if err != nil {
+			return nil, err
+		}
+		if r.Method == "POST" {
+			return s.startTask(vm.Node, "qmconfig", id, user), nil
+		}
+		return nil, nil
+	case match(path, "status", "current") && r.Method == "GET":
+		return s.vmStatus(vm), nil
+	case match(path, "status", "*") && r.Method == "POST":
+		return s.changeStatus(vm, path[1], user)
+	case match(path, "clone") && r.Method == "POST":
+		return s.cloneVM(r, vm, user)
+	case match(path, "snapshot") || (len(path) >= 2 && path[0] == "snapshot"):
+		return s.snapshot(r, vm, path[1:], user)
+	case match(path, "cloudinit") && r.Method == "PUT":
+		return nil, nil
+	case match(path, "cloudinit", "dump") && r.Method == "GET":
+		return s.cloudInitDump(vm, r.Form.Get("type"))
+	case len(path) == 2 && path[0] == "agent":
+		return s.agent(r, vm, path[1])
+	case match(path, "migrate") && r.Method == "GET":
+		return s.migrateCheck(vm, r.Form.Get("target")), nil
+	case match(path, "migrate") && r.Method == "POST":
+		return s.migrateVM(r, vm, user)
+	}
+	return nil, errorf(http.StatusNotImplemented, "Method '%s /nodes/%s/qemu/%d/%s' not implemented", r.Method, vm.Node, vm.VMID, strings.Join(path, "/"))
+}
+
+func (s *Server) listNodes() []map[string]interface{} {
+	var result []map[string]interface{}
+
+	for _, name := range sortedKeys(s.nodes) {
+		node := s.nodes[name]
+		item := map[string]interface{}{
+			"node":   node.Name,
+			"id":     "node/" + node.Name,
+			"type":   "node",
+			"level":  "",
+			"status": "offline",
+		}
+		if node.Online {
+			item["status"] = "online"
+			item["uptime"] = node.Uptime
+			item["cpu"] = node.CPU
+			item["maxcpu"] = node.MaxCPU
+			item["mem"] = node.Mem
+			item["maxmem"] = node.MaxMem
+			item["disk"] = 0
+			item["maxdisk"] = 100 << 30
+		}
+		result = append(result, item)
+	}
+	return result
+}
+
+// clusterStatus reports a cluster named "pve-cluster" once there is more than
+// one node. DefaultNode is the local node.
+func (s *Server) clusterStatus() []map[string]interface{} {
+	var result []map[string]interface{}
+	var online int
+
+	for i, name := range sortedKeys(s.nodes) {
+		node := s.nodes[name]
+		item := map[string]interface{}{
+			"id":     "node/" + name,
+			"type":   "node",
+			"name":   name,
+			"nodeid": i + 1,
+			"ip":     "127.0.0." + strconv.Itoa(i+1),
+			"level":  "",
+			"online": 0,
+			"local":  0,
+		}
+		if node.Online {
+			item["online"] = 1
+			online++
+		}
+		if name == DefaultNode {
+			item["local"] = 1
+		}
+		result = append(result, item)
+	}
+	if len(s.nodes) > 1 {
+		quorate := 0
+		if online*2 > len(s.nodes) {
+			quorate = 1
+		}
+		result = append([]map[string]interface{}{{
+			"id":      "cluster",
+			"type":    "cluster",
+			"name":    "pve-cluster",
+			"nodes":   len(s.nodes),
+			"quorate": quorate,
+			"version": len(s.nodes),
+		}}, result...)
+	}
+	return result
+}
+
+// listResources returns the cluster/resources view of nodes, VMs, storages and
+// pools. Storages are reported on every online node.
+func (s *Server) listResources(kind string) []map[string]interface{} {
+	var result []map[string]interface{}
+
+	if kind == "" || kind == "node" {
+		result = append(result, s.listNodes()...)
+	}
+	if kind == "" || kind == "vm" {
+		for _, vmid := range sortedIntKeys(s.vms) {
+			vm := s.vms[vmid]
+			item := s.vmStatus(vm)
+			item["id"] = "qemu/" + strconv.Itoa(vm.VMID)
+			item["type"] = "qemu"
+			item["node"] = vm.Node
+			item["maxcpu"] = item["cpus"]
+			delete(item, "cpus")
+			if vm.Pool != "" {
+				item["pool"] = vm.Pool
+			}
+			result = append(result, item)
+		}
+	}
+	if kind == "" || kind == "storage" {
+		for _, node := range sortedKeys(s.nodes) {
+			if !s.nodes[node].Online {
+				continue
+			}
+			for _, name := range sortedKeys(s.storages) {
+				storage := s.storages[name]
+				shared := 0
+				if storage.Shared {
+					shared = 1
+				}
+				result = append(result, map[string]interface{}{
+					"id":         "storage/" + node + "/" + storage.Name,
+					"type":       "storage",
+					"node":       node,
+					"storage":    storage.Name,
+					"plugintype": storage.Type,
+					"content":    storage.Content,
+					"shared":     shared,
+					"status":     "available",
+					"disk":       storage.Used,
+					"maxdisk":    storage.Total,
+				})
+			}
+		}
+	}
+	if kind == "" {
+		for _, id := range sortedKeys(s.pools) {
+			result = append(result, map[string]interface{}{"id": "/pool/" + id, "type": "pool", "pool": id})
+		}
+	}
+	return result
+}
+
+func (s *Server) nextID() int {
+	id := 100
+	for {
+		if _, ok := s.vms[id]; !ok {
+			return id
+		}
+		id++
+	}
+}
+
+func (s *Server) listVMs(node string) []map[string]interface{} {
+	var result []map[string]interface{}
+
+	for _, vmid := range sortedIntKeys(s.vms) {
+		vm := s.vms[vmid]
+		if vm.Node != node {
+			continue
+		}
+		result = append(result, s.vmStatus(vm))
+	}
+	return result
+}
+
+func (s *Server) vmStatus(vm *VM) map[string]interface{} {
+	memory, _ := strconv.ParseInt(vm.Config["memory"], 10, 64)
+	cores, _ := strconv.Atoi(vm.Config["cores"])
+	sockets, _ := strconv.Atoi(vm.Config["sockets"])
+	result := map[string]interface{}{
+		"vmid":      vm.VMID,
+		"name":      vm.Config["name"],
+		"status":    vm.Status,
+		"qmpstatus": vm.Status,
+		"cpus":      cores * sockets,
+		"maxmem":    memory << 20,
+		"mem":       0,
+		"cpu":       0,
+		"disk":      0,
+		"maxdisk":   0,
+		"diskread":  0,
+		"diskwrite": 0,
+		"netin":     0,
+		"netout":    0,
+		"uptime":    0,
+	}
+	if vm.Status == "running" {
+		result["mem"] = (memory << 20) / 2
+		result["uptime"] = 60
+		result["pid"] = 1000 + vm.VMID
+		if vm.Paused {
+			result["qmpstatus"] = "paused"
+		}
+	}
+	if vm.Template {
+		result["template"] = 1
+	} else {
+		result["template"] = ""
+	}
+	return result
+}
+
+func (s *Server) vmConfig(vm *VM) map[string]interface{} {
+	result := make(map[string]interface{})
+	for k, v := range vm.Config {
+		if n, err := strconv.ParseInt(v, 10, 64); err == nil && (k == "memory" || k == "cores" || k == "sockets" || k == "onboot") {
+			result[k] = n
+		} else {
+			result[k] = v
+		}
+	}
+	if vm.Template {
+		result["template"] = 1
+	}
+	if _, ok := result["cipassword"]; ok {
+		result["cipassword"] = "**********"
+	}
+	result["digest"] = digest(vm.Config)
+	return result
+}
+
+func digest(config map[string]string) string {
+	var b strings.Builder
+
+	for _, k := range sortedKeys(config) {
+		b.WriteString(k + ": " + config[k] + "\n")
+	}
+	sum := sha1.Sum([]byte(b.String()))
+	return hex.EncodeToString(sum[:])
+}
+
+func (s *Server) updateConfig(vm *VM, form map[string][]string) *apiError {
+	if d := firstValue(form, "digest"); d != "" && d != digest(vm.Config) {
+		return errorf(http.StatusInternalServerError, "detected modified configuration - file changed by other user? Try again.")
+	}
+	for k, v := range form {
+		switch k {
+		case "digest", "delete", "revert", "skiplock", "background_delay":
+			continue
+		}
+		vm.Config[k] = v[0]
+		if k == "name" {
+			vm.Name = v[0]
+		}
+	}
+	for _, k := range strings.FieldsFunc(firstValue(form, "delete"), func(r rune) bool { return r == ',' || r == ';' || r == ' ' }) {
+		delete(vm.Config, k)
+	}
+	return nil
+}
+
+func (s *Server) changeStatus(vm *VM, action string, user string) (interface{}, *apiError) {
+	id := strconv.Itoa(vm.VMID)
+	switch action {
+	case "start":
+		if vm.Template {
+			return nil, errorf(http.StatusInternalServerError, "you can't start a vm if it's a template")
+		}
+		if vm.Status == "running" {
+			return nil, errorf(http.StatusInternalServerError, "VM %d already running", vm.VMID)
+		}
+		vm.Status = "running"
+		vm.Paused = false
+		return s.startTask(vm.Node, "qmstart", id, user), nil
+	case "stop", "shutdown":
+		if vm.Status != "running" && action == "shutdown" {
+			return nil, errorf(http.StatusInternalServerError, "VM %d not running", vm.VMID)
+		}
+		vm.Status = "stopped"
+		vm.Paused = false
+		return s.startTask(vm.Node, "qm"+action, id, user), nil
+	case "reboot", "reset":
+		if vm.Status != "running" {
+			return nil, errorf(http.StatusInternalServerError, "VM %d not running", vm.VMID)
+		}
+		return s.startTask(vm.Node, "qm"+action, id, user), nil
+	case "suspend", "resume":
+		if vm.Status != "running" {
+			return nil, errorf(http.StatusInternalServerError, "VM %d not running", vm.VMID)
+		}
+		vm.Paused = action == "suspend"
+		return s.startTask(vm.Node, "qm"+action, id, user), nil
+	}
+	return nil, errorf(http.StatusNotImplemented, "Method 'POST /nodes/%s/qemu/%d/status/%s' not implemented", vm.Node, vm.VMID, action)
+}
+
+func (s *Server) createVM(r *http.Request, node *Node, user string) (interface{}, *apiError) {
+	vmid, err := strconv.Atoi(r.PostForm.Get("vmid"))
+	if err != nil {
+		return nil, paramError("vmid", "property is missing and it is not optional")
+	}
+	if _, ok := s.vms[vmid]; ok {
+		return nil, errorf(http.StatusInternalServerError, "unable to create VM %d - VM %d already exists on node '%s'", vmid, vmid, node.Name)
+	}
+	vm := &VM{VMID: vmid, Node: node.Name, Status: "stopped", Config: map[string]string{"memory": "512", "cores": "1", "sockets": "1"}}
+	for k, v := range r.PostForm {
+		switch k {
+		case "vmid", "start", "pool", "storage", "unique", "force", "archive":
+			continue
+		}
+		vm.Config[k] = v[0]
+	}
+	if err := s.allocateDisks(vm); err != nil {
+		return nil, err
+	}
+	vm.Name = vm.Config["name"]
+	vm.Pool = r.PostForm.Get("pool")
+	s.vms[vmid] = vm
+	if r.PostForm.Get("start") == "1" {
+		vm.Status = "running"
+	}
+	return s.startTask(node.Name, "qmcreate", strconv.Itoa(vmid), user), nil
+}
+
+// allocateDisks creates the volumes for disks given as "STORAGE:SIZE_IN_GiB".
+func (s *Server) allocateDisks(vm *VM) *apiError {
+	var n int
+
+	for _, key := range sortedKeys(vm.Config) {
+		if key == "ide2" || !(strings.HasPrefix(key, "ide") || strings.HasPrefix(key, "sata") ||
+			strings.HasPrefix(key, "scsi") || strings.HasPrefix(key, "virtio") || key == "efidisk0") {
+			continue
+		}
+		parts := strings.SplitN(vm.Config[key], ",", 2)
+		name, size, ok := strings.Cut(parts[0], ":")
+		gib, err := strconv.ParseFloat(size, 64)
+		if !ok || err != nil {
+			continue
+		}
+		storage, ok := s.storages[name]
+		if !ok {
+			return errorf(http.StatusInternalServerError, "storage '%s' does not exist", name)
+		}
+		volid := fmt.Sprintf("%s:vm-%d-disk-%d", name, vm.VMID, n)
+		n++
+		storage.Volumes[volid] = int64(gib * (1 << 30))
+		storage.Used += int64(gib * (1 << 30))
+		vm.Config[key] = volid
+		if len(parts) == 2 {
+			vm.Config[key] += "," + parts[1]
+		}
+		vm.Config[key] += ",size=" + strconv.FormatFloat(gib, 'f', -1, 64) + "G"
+	}
+	return nil
+}
+
+func (s *Server) cloneVM(r *http.Request, vm *VM, user string) (interface{}, *apiError) {
+	newid, err := strconv.Atoi(r.PostForm.Get("newid"))
+	if err != nil {
+		return nil, paramError("newid", "property is missing and it is not optional")
+	}
+	if _, ok := s.vms[newid]; ok {
+		return nil, errorf(http.StatusInternalServerError, "unable to create VM %d: config file already exists", newid)
+	}
+	clone := &VM{VMID: newid, Node: vm.Node, Status: "stopped", Config: make(map[string]string)}
+	for k, v := range vm.Config {
+		clone.Config[k] = v
+	}
+	if name := r.PostForm.Get("name"); name != "" {
+		clone.Config["name"] = name
+	}
+	clone.Name = clone.Config["name"]
+	if target := r.PostForm.Get("target"); target != "" {
+		if _, ok := s.nodes[target]; !ok {
+			return nil, paramError("target", "no such cluster node '"+target+"'")
+		}
+		clone.Node = target
+	}
+	clone.Pool = r.PostForm.Get("pool")
+	s.vms[newid] = clone
+	return s.startTask(vm.Node, "qmclone", strconv.Itoa(vm.VMID), user), nil
+}
+
+func (s *Server) snapshot(r *http.Request, vm *VM, path []string, user string) (interface{}, *apiError) {
+	id := strconv.Itoa(vm.VMID)
+	if vm.Snapshots == nil {
+		vm.Snapshots = make(map[string]*Snapshot)
+	}
+	if match(path) {
+		switch r.Method {
+		case "GET":
+			var result []map[string]interface{}
+			for _, name := range sortedKeys(vm.Snapshots) {
+				snapshot := vm.Snapshots[name]
+				item := map[string]interface{}{
+					"name":        snapshot.Name,
+					"description": snapshot.Description,
+					"snaptime":    snapshot.SnapTime,
+				}
+				if snapshot.Parent != "" {
+					item["parent"] = snapshot.Parent
+				}
+				if snapshot.VMState {
+					item["vmstate"] = 1
+				}
+				result = append(result, item)
+			}
+			current := map[string]interface{}{"name": "current", "description": "You are here!", "digest": digest(vm.Config)}
+			if vm.Parent != "" {
+				current["parent"] = vm.Parent
+			}
+			return append(result, current), nil
+		case "POST":
+			name := r.PostForm.Get("snapname")
+			if name == "" {
+				return nil, paramError("snapname", "property is missing and it is not optional")
+			}
+			if _, ok := vm.Snapshots[name]; ok || name == "current" {
+				return nil, errorf(http.StatusInternalServerError, "snapshot name '%s' already used", name)
+			}
+			snapshot := &Snapshot{
+				Name:        name,
+				Description: r.PostForm.Get("description"),
+				Parent:      vm.Parent,
+				SnapTime:    time.Now().Unix(),
+				VMState:     r.PostForm.Get("vmstate") == "1",
+				Config:      make(map[string]string),
+			}
+			for k, v := range vm.Config {
+				snapshot.Config[k] = v
+			}
+			vm.Snapshots[name] = snapshot
+			vm.Parent = name
+			return s.startTask(vm.Node, "qmsnapshot", id, user), nil
+		}
+	}
+
+	snapshot, ok := vm.Snapshots[path[0]]
+	if !ok {
+		return nil, errorf(http.StatusInternalServerError, "snapshot '%s' does not exist", path[0])
+	}
+	switch {
+	case match(path, "*") && r.Method == "DELETE":
+		for _, other := range vm.Snapshots {
+			if other.Parent == snapshot.Name {
+				other.Parent = snapshot.Parent
+			}
+		}
+		if vm.Parent == snapshot.Name {
+			vm.Parent = snapshot.Parent
+		}
+		delete(vm.Snapshots, snapshot.Name)
+		return s.startTask(vm.Node, "qmdelsnapshot", id, user), nil
+	case match(path, "*", "config") && r.Method == "GET":
+		result := make(map[string]interface{})
+		for k, v := range snapshot.Config {
+			result[k] = v
+		}
+		result["snaptime"] = snapshot.SnapTime
+		result["description"] = snapshot.Description
+		if snapshot.Parent != "" {
+			result["parent"] = snapshot.Parent
+		}
+		return result, nil
+	case match(path, "*", "config") && r.Method == "PUT":
+		snapshot.Description = r.PostForm.Get("description")
+		return nil, nil
+	case match(path, "*", "rollback") && r.Method == "POST":
+		vm.Config = make(map[string]string)
+		for k, v := range snapshot.Config {
+			vm.Config[k] = v
+		}
+		vm.Parent = snapshot.Name
+		vm.Status = "stopped"
+		if snapshot.VMState {
+			vm.Status = "running"
+		}
+		return s.startTask(vm.Node, "qmrollback", id, user), nil
+	}
+	return nil, errorf(http.StatusNotImplemented, "Method '%s /nodes/%s/qemu/%d/snapshot/%s' not implemented", r.Method, vm.Node, vm.VMID, strings.Join(path, "/"))
+}
+
+// cloudInitDump renders a simplified version of the generated cloud-init
+// data. The SSH keys are stored URL encoded in the configuration.
+func (s *Server) cloudInitDump(vm *VM, dumpType string) (interface{}, *apiError) {
+	var b strings.Builder
+
+	switch dumpType {
+	case "user":
+		b.WriteString("#cloud-config\nhostname: " + vm.Config["name"] + "\nmanage_etc_hosts: true\n")
+		if user := vm.Config["ciuser"]; user != "" {
+			b.WriteString("user: " + user + "\n")
+		}
+		if keys, err := url.QueryUnescape(vm.Config["sshkeys"]); err == nil && keys != "" {
+			b.WriteString("ssh_authorized_keys:\n")
+			for _, key := range strings.Split(strings.TrimSpace(keys), "\n") {
+				b.WriteString("  - " + key + "\n")
+			}
+		}
+		b.WriteString("package_upgrade: true\n")
+	case "network":
+		b.WriteString("version: 1\nconfig:\n")
+		for i := 0; i < 32; i++ {
+			ipconfig, ok := vm.Config["ipconfig"+strconv.Itoa(i)]
+			if !ok {
+				continue
+			}
+			b.WriteString(fmt.Sprintf("    - type: physical\n      name: eth%d\n      subnets:\n", i))
+			for _, option := range strings.Split(ipconfig, ",") {
+				if k, v, _ := strings.Cut(option, "="); k == "ip" && v == "dhcp" {
+					b.WriteString("      - type: dhcp4\n")
+				} else if k == "ip" {
+					b.WriteString("      - type: static\n        address: '" + v + "'\n")
+				} else if k == "gw" {
+					b.WriteString("        gateway: '" + v + "'\n")
+				}
+			}
+		}
+		if ns := vm.Config["nameserver"]; ns != "" {
+			b.WriteString("    - type: nameserver\n      address:\n      - '" + ns + "'\n")
+			if sd := vm.Config["searchdomain"]; sd != "" {
+				b.WriteString("      search:\n      - '" + sd + "'\n")
+			}
+		}
+	case "meta":
+		b.WriteString("instance-id: " + digest(vm.Config) + "\n")
+	default:
+		return nil, paramError("type", "value '"+dumpType+"' does not have a value in the enumeration 'user, network, meta'")
+	}
+	return b.String(), nil
+}
+
+// agent answers guest agent commands like a Linux guest with one network
+// interface and a root filesystem.
+func (s *Server) agent(r *http.Request, vm *VM, command string) (interface{}, *apiError) {
+	if enabled := strings.SplitN(vm.Config["agent"], ",", 2)[0]; enabled != "1" && enabled != "enabled=1" {
+		return nil, errorf(http.StatusInternalServerError, "No QEMU guest agent configured")
+	}
+	if vm.Status != "running" {
+		return nil, errorf(http.StatusInternalServerError, "VM %d is not running", vm.VMID)
+	}
+	if vm.Files == nil {
+		vm.Files = make(map[string]string)
+	}
+	switch command {
+	case "ping":
+		return map[string]interface{}{}, nil
+	case "exec":
+		cmd := r.PostForm["command"]
+		if len(cmd) == 0 {
+			return nil, paramError("command", "property is missing and it is not optional")
+		}
+		exitCode, stdout, stderr := 0, strings.Join(cmd[1:], " ")+"\n", ""
+		if s.Exec != nil {
+			exitCode, stdout, stderr = s.Exec(*vm, cmd, r.PostForm.Get("input-data"))
+		}
+		pid := 1000 + len(s.execs)
+		s.execs[pid] = &execState{
+			status: map[string]interface{}{"exited": 1, "exitcode": exitCode, "out-data": stdout, "err-data": stderr},
+			end:    time.Now().Add(s.ExecDuration),
+		}
+		return map[string]interface{}{"pid": pid}, nil
+	case "exec-status":
+		pid, _ := strconv.Atoi(r.Form.Get("pid"))
+		exec, ok := s.execs[pid]
+		if !ok {
+			return nil, errorf(http.StatusInternalServerError, "Agent error: Invalid parameter 'pid'")
+		}
+		if time.Now().Before(exec.end) {
+			return map[string]interface{}{"exited": 0}, nil
+		}
+		return exec.status, nil
+	case "file-read":
+		content, ok := vm.Files[r.Form.Get("file")]
+		if !ok {
+			return nil, errorf(http.StatusInternalServerError, "Agent error: failed to open file '%s': No such file or directory", r.Form.Get("file"))
+		}
+		return map[string]interface{}{"content": content, "bytes-read": len(content)}, nil
+	case "file-write":
+		vm.Files[r.PostForm.Get("file")] = r.PostForm.Get("content")
+		return nil, nil
+	case "network-get-interfaces":
+		return map[string]interface{}{"result": []map[string]interface{}{{
+			"name":             "eth0",
+			"hardware-address": fmt.Sprintf("bc:24:11:00:%02x:%02x", vm.VMID/256%256, vm.VMID%256),
+			"ip-addresses": []map[string]interface{}{{
+				"ip-address":      fmt.Sprintf("10.0.%d.%d", vm.VMID/256%256, vm.VMID%256),
+				"ip-address-type": "ipv4",
+				"prefix":          24,
+			}},
+		}}}, nil
+	case "get-osinfo":
+		return map[string]interface{}{"result": map[string]interface{}{
+			"id": "debian", "name": "Debian GNU/Linux", "pretty-name": "Debian GNU/Linux 12 (bookworm)",
+			"version": "12 (bookworm)", "version-id": "12", "kernel-release": "6.1.0-21-amd64",
+			"kernel-version": "#1 SMP PREEMPT_DYNAMIC Debian 6.1.90-1", "machine": "x86_64",
+		}}, nil
+	case "get-fsinfo":
+		return map[string]interface{}{"result": []map[string]interface{}{{
+			"name": "sda1", "mountpoint": "/", "type": "ext4", "total-bytes": 32 << 30, "used-bytes": 4 << 30,
+		}}}, nil
+	case "fsfreeze-freeze":
+		vm.Frozen = true
+		return map[string]interface{}{"result": 1}, nil
+	case "fsfreeze-thaw":
+		vm.Frozen = false
+		return map[string]interface{}{"result": 1}, nil
+	case "fsfreeze-status":
+		if vm.Frozen {
+			return map[string]interface{}{"result": "frozen"}, nil
+		}
+		return map[string]interface{}{"result": "thawed"}, nil
+	case "set-user-password":
+		return nil, nil
+	}
+	return nil, errorf(http.StatusNotImplemented, "Method '%s /nodes/%s/qemu/%d/agent/%s' not implemented", r.Method, vm.Node, vm.VMID, command)
+}
+
+// localDisks returns the volumes of vm on storages which are not shared.
+func (s *Server) localDisks(vm *VM) []map[string]interface{} {
+	var result []map[string]interface{}
+
+	for _, key := range sortedKeys(vm.Config) {
+		volid := strings.SplitN(vm.Config[key], ",", 2)[0]
+		name, _, ok := strings.Cut(volid, ":")
+		storage, found := s.storages[name]
+		if !ok || !found || storage.Shared {
+			continue
+		}
+		if _, exists := storage.Volumes[volid]; !exists && !strings.Contains(vm.Config[key], "media=cdrom") {
+			continue
+		}
+		item := map[string]interface{}{
+			"volid":                volid,
+			"size":                 storage.Volumes[volid],
+			"referenced_in_config": 1,
+			"is_unused":            0,
+		}
+		if strings.Contains(vm.Config[key], "media=cdrom") {
+			item["cdrom"] = 1
+		}
+		result = append(result, item)
+	}
+	return result
+}
+
+// migrateCheck reports the offline nodes as not allowed. Local resources are
+// the configured hostpci and usb devices.
+func (s *Server) migrateCheck(vm *VM, target string) map[string]interface{} {
+	var allowed []string
+	var local []string
+
+	notAllowed := make(map[string]interface{})
+	for _, name := range sortedKeys(s.nodes) {
+		if name == vm.Node || (target != "" && name != target) {
+			continue
+		}
+		if s.nodes[name].Online {
+			allowed = append(allowed, name)
+		} else {
+			notAllowed[name] = map[string]interface{}{"unavailable_storages": []string{}}
+		}
+	}
+	for _, key := range sortedKeys(vm.Config) {
+		if strings.HasPrefix(key, "hostpci") || strings.HasPrefix(key, "usb") {
+			local = append(local, key)
+		}
+	}
+	running := 0
+	if vm.Status == "running" {
+		running = 1
+	}
+	return map[string]interface{}{
+		"running":           running,
+		"allowed_nodes":     allowed,
+		"not_allowed_nodes": notAllowed,
+		"local_disks":       s.localDisks(vm),
+		"local_resources":   local,
+		"mapped-resources":  []string{},
+	}
+}
+
+func (s *Server) migrateVM(r *http.Request, vm *VM, user string) (interface{}, *apiError) {
+	target := r.PostForm.Get("target")
+	node, ok := s.nodes[target]
+	if !ok {
+		return nil, paramError("target", "no such cluster node '"+target+"'")
+	}
+	if target == vm.Node {
+		return nil, paramError("target", "target is local node.")
+	}
+	if !node.Online {
+		return nil, errorf(http.StatusInternalServerError, "migration aborted: target node '%s' is not online", target)
+	}
+	if vm.Status == "running" && r.PostForm.Get("online") != "1" {
+		return nil, errorf(http.StatusInternalServerError, "can't migrate running VM without --online")
+	}
+	if len(s.localDisks(vm)) > 0 && r.PostForm.Get("with-local-disks") != "1" {
+		return nil, errorf(http.StatusInternalServerError, "can't migrate VM with local disks without --with-local-disks")
+	}
+	source := vm.Node
+	vm.Node = target
+	return s.startTask(source, "qmigrate", strconv.Itoa(vm.VMID), user), nil
+}
+
+func (s *Server) listStorages(node string) []map[string]interface{} {
+	var result []map[string]interface{}
+
+	for _, name := range sortedKeys(s.storages) {
+		storage := s.storages[name]
+		shared := 0
+		if storage.Shared {
+			shared = 1
+		}
+		item := map[string]interface{}{
+			"storage": storage.Name,
+			"type":    storage.Type,
+			"content": storage.Content,
+			"shared":  shared,
+		}
+		if node != "" {
+			item["active"] = 1
+			item["enabled"] = 1
+			item["total"] = storage.Total
+			item["used"] = storage.Used
+			item["avail"] = storage.Total - storage.Used
+		}
+		result = append(result, item)
+	}
+	return result
+}
+
+func (s *Server) handleContent(r *http.Request, node *Node, name string) (interface{}, *apiError) {
+	storage, ok := s.storages[name]
+	if !ok {
+		return nil, errorf(http.StatusInternalServerError, "storage '%s' does not exist", name)
+	}
+	switch r.Method {
+	case "GET":
+		var result []map[string]interface{}
+		for _, volid := range sortedKeys(storage.Volumes) {
+			item := map[string]interface{}{
+				"volid":   volid,
+				"size":    storage.Volumes[volid],
+				"used":    storage.Volumes[volid],
+				"format":  "raw",
+				"content": "images",
+			}
+			if strings.HasSuffix(volid, ".qcow2") {
+				item["format"] = "qcow2"
+			}
+			if parts := strings.SplitN(strings.TrimPrefix(volid, name+":"), "/", 2); len(parts) == 2 {
+				if vmid, err := strconv.Atoi(parts[0]); err == nil {
+					item["vmid"] = vmid
+				}
+			}
+			result = append(result, item)
+		}
+		return result, nil
+	case "POST":
+		filename := r.PostForm.Get("filename")
+		vmid := r.PostForm.Get("vmid")
+		if filename == "" {
+			return nil, paramError("filename", "property is missing and it is not optional")
+		}
+		size, err := parseSize(r.PostForm.Get("size"))
+		if err != nil {
+			return nil, paramError("size", err.Error())
+		}
+		volid := name + ":" + vmid + "/" + filename
+		if _, ok := storage.Volumes[volid]; ok {
+			return nil, errorf(http.StatusInternalServerError, "volume '%s' already exists", volid)
+		}
+		storage.Volumes[volid] = size
+		storage.Used += size
+		return volid, nil
+	}
+	return nil, errorf(http.StatusNotImplemented, "Method '%s /nodes/%s/storage/%s/content' not implemented", r.Method, node.Name, name)
+}
+
+// parseSize parses sizes like "32G" or "512M", plain numbers are kilobytes.
+func parseSize(size string) (int64, error) {
+	units := map[string]int64{"K": 1 << 10, "M": 1 << 20, "G": 1 << 30, "T": 1 << 40}
+	unit := int64(1 << 10)
+	if size != "" {
+		if u, ok := units[strings.ToUpper(size[len(size)-1:])]; ok {
+			unit = u
+			size = size[:len(size)-1]
+		}
+	}
+	n, err := strconv.ParseInt(size, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size '%s'", size)
+	}
+	return n * unit, nil
+}
+
+func (s *Server) handlePools(r *http.Request) (interface{}, *apiError) {
+	switch r.Method {
+	case "GET":
+		var result []map[string]interface{}
+		for _, id := range sortedKeys(s.pools) {
+			result = append(result, map[string]interface{}{"poolid": id, "comment": s.pools[id].Comment})
+		}
+		return result, nil
+	case "POST":
+		id := r.PostForm.Get("poolid")
+		if id == "" {
+			return nil, paramError("poolid", "property is missing and it is not optional")
+		}
+		if _, ok := s.pools[id]; ok {
+			return nil, errorf(http.StatusInternalServerError, "create pool failed: pool '%s' already exists", id)
+		}
+		s.pools[id] = &Pool{PoolID: id, Comment: r.PostForm.Get("comment")}
+		return nil, nil
+	}
+	return nil, errorf(http.StatusNotImplemented, "Method '%s /pools' not implemented", r.Method)
+}
+
+func (s *Server) handlePool(r *http.Request, id string) (interface{}, *apiError) {
+	pool, ok := s.pools[id]
+	if !ok {
+		return nil, errorf(http.StatusInternalServerError, "pool '%s' does not exist", id)
+	}
+	switch r.Method {
+	case "GET":
+		var members []map[string]interface{}
+		for _, vmid := range sortedIntKeys(s.vms) {
+			if vm := s.vms[vmid]; vm.Pool == id {
+				members = append(members, map[string]interface{}{"vmid": vm.VMID, "node": vm.Node, "type": "qemu", "id": "qemu/" + strconv.Itoa(vm.VMID)})
+			}
+		}
+		return map[string]interface{}{"comment": pool.Comment, "members": members}, nil
+	case "PUT":
+		if _, ok := r.PostForm["comment"]; ok {
+			pool.Comment = r.PostForm.Get("comment")
+		}
+		return nil, nil
+	case "DELETE":
+		for _, vm := range s.vms {
+			if vm.Pool == id {
+				return nil, errorf(http.StatusInternalServerError, "delete pool failed: pool '%s' is not empty", id)
+			}
+		}
+		delete(s.pools, id)
+		return nil, nil
+	}
+	return nil, errorf(http.StatusNotImplemented, "Method '%s /pools/%s' not implemented", r.Method, id)
+}
+
+// startTask registers a new task. It is finished after TaskDuration with
+// exit status OK.
+func (s *Server) startTask(node string, taskType string, id string, user string) string {
+	s.taskCount++
+	now := time.Now()
+	pid := 10000 + s.taskCount
+	upid := fmt.Sprintf("UPID:%s:%08X:%08X:%08X:%s:%s:%s:", node, pid, pid*100, now.Unix(), taskType, id, user)
+	s.tasks = append(s.tasks, &Task{
+		UPID:       upid,
+		Node:       node,
+		Type:       taskType,
+		ID:         id,
+		User:       user,
+		ExitStatus: "OK",
+		Log:        []string{"starting " + taskType + " " + id, "TASK OK"},
+		start:      now,
+		duration:   s.TaskDuration,
+	})
+	return upid
+}
+
+// FailTask makes the task with the given UPID end with an error.
+func (s *Server) FailTask(upid string, exitStatus string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, t := range s.tasks {
+		if t.UPID == upid {
+			t.ExitStatus = exitStatus
+			t.Log = append(t.Log[:len(t.Log)-1], "TASK ERROR: "+exitStatus)
+		}
+	}
+}
+
+// SetTaskLog replaces the log of the task with the given UPID by lines,
+// followed by its final status line. While the task runs, the lines show up
+// one after another.
+func (s *Server) SetTaskLog(upid string, lines ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, t := range s.tasks {
+		if t.UPID == upid {
+			t.Log = append(append([]string{}, lines...), t.Log[len(t.Log)-1])
+		}
+	}
+}
+
+func (s *Server) findTask(upid string) (*Task, *apiError) {
+	for _, t := range s.tasks {
+		if t.UPID == upid {
+			return t, nil
+		}
+	}
+	return nil, errorf(http.StatusInternalServerError, "unable to open file - No such file or directory")
+}
+
+func (t *Task) running() bool {
+	return time.Since(t.start) < t.duration
+}
+
+func (t *Task) data() map[string]interface{} {
+	parts := strings.Split(t.UPID, ":")
+	pid, _ := strconv.ParseInt(parts[2], 16, 64)
+	pstart, _ := strconv.ParseInt(parts[3], 16, 64)
+	result := map[string]interface{}{
+		"upid":      t.UPID,
+		"node":      t.Node,
+		"type":      t.Type,
+		"id":        t.ID,
+		"user":      t.User,
+		"pid":       pid,
+		"pstart":    pstart,
+		"starttime": t.start.Unix(),
+		"status":    "running",
+	}
+	if !t.running() {
+		result["status"] = "stopped"
+		result["exitstatus"] = t.ExitStatus
+		result["endtime"] = t.start.Add(t.duration).Unix()
+	}
+	return result
+}
+
+func (s *Server) listTasks(node string, form map[string][]string) []map[string]interface{} {
+	var result []map[string]interface{}
+
+	vmid := firstValue(form, "vmid")
+	for i := len(s.tasks) - 1; i >= 0; i-- {
+		t := s.tasks[i]
+		if (node != "" && t.Node != node) || (vmid != "" && t.ID != vmid) {
+			continue
+		}
+		result = append(result, t.data())
+	}
+	start, _ := strconv.Atoi(firstValue(form, "start"))
+	limit, _ := strconv.Atoi(firstValue(form, "limit"))
+	if start > len(result) {
+		start = len(result)
+	}
+	result = result[start:]
+	if limit > 0 && limit < len(result) {
+		result = result[:limit]
+	}
+	return result
+}
+
+func (s *Server) taskStatus(upid string) (interface{}, *apiError) {
+	t, err := s.findTask(upid)
+	if err != nil {
+		return nil, err
+	}
+	return t.data(), nil
+}
+
+func (s *Server) taskLog(upid string, form map[string][]string) (interface{}, *apiError) {
+	var result []map[string]interface{}
+
+	t, err := s.findTask(upid)
+	if err != nil {
+		return nil, err
+	}
+	lines := t.Log
+	if t.running() {
+		visible := time.Duration(len(lines)-1) * time.Since(t.start) / t.duration
+		lines = lines[:visible]
+	}
+	start, _ := strconv.Atoi(firstValue(form, "start"))
+	limit, _ := strconv.Atoi(firstValue(form, "limit"))
+	if limit == 0 {
+		limit = 50
+	}
+	for i := start; i < len(lines) && i < start+limit; i++ {
+		result = append(result, map[string]interface{}{"n": i + 1, "t": lines[i]})
+	}
+	// Like Proxmox VE, answer an empty page with a placeholder.
+	if len(result) == 0 {
+		result = append(result, map[string]interface{}{"n": 1, "t": "no content"})
+	}
+	return result, nil
+}
+
+func firstValue(form map[string][]string, key string) string {
+	if v, ok := form[key]; ok && len(v) > 0 {
+		return v[0]
+	}
+	return ""
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	var keys []string
+
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func sortedIntKeys[V any](m map[int]V) []int {
+	var keys []int
+
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Ints(keys)
+	return keys
+}
@@ -1,6 +1,7 @@
 package proxmox
 
 import (
+	"context"
 	"errors"
 	"net/url"
 	"strconv"
@@ -30,18 +31,62 @@ type QemuVM struct {
 
 type QemuList map[string]QemuVM
 
-type QemuNet map[string]string
+type qemuData struct {
+	Mem       flexFloat  `json:"mem"`
+	CPUs      flexFloat  `json:"cpus"`
+	NetOut    flexFloat  `json:"netout"`
+	PID       flexString `json:"pid"`
+	Disk      flexFloat  `json:"disk"`
+	MaxMem    flexFloat  `json:"maxmem"`
+	Status    flexString `json:"status"`
+	Template  flexFloat  `json:"template"`
+	NetIn     flexFloat  `json:"netin"`
+	MaxDisk   flexFloat  `json:"maxdisk"`
+	Name      flexString `json:"name"`
+	DiskWrite flexFloat  `json:"diskwrite"`
+	CPU       flexFloat  `json:"cpu"`
+	VMId      flexFloat  `json:"vmid"`
+	DiskRead  flexFloat  `json:"diskread"`
+	Uptime    flexFloat  `json:"uptime"`
+}
+
+func (v qemuData) qemu(node Node) QemuVM {
+	return QemuVM{
+		Mem:       float64(v.Mem),
+		CPUs:      float64(v.CPUs),
+		NetOut:    float64(v.NetOut),
+		PID:       string(v.PID),
+		Disk:      float64(v.Disk),
+		MaxMem:    float64(v.MaxMem),
+		Status:    string(v.Status),
+		Template:  float64(v.Template),
+		NetIn:     float64(v.NetIn),
+		MaxDisk:   float64(v.MaxDisk),
+		Name:      string(v.Name),
+		DiskWrite: float64(v.DiskWrite),
+		CPU:       float64(v.CPU),
+		VMId:      float64(v.VMId),
+		DiskRead:  float64(v.DiskRead),
+		Uptime:    float64(v.Uptime),
+		Node:      node,
+	}
+}
 
-type QemuConfig struct {
-	Bootdisk    string  `json:"bootdisk"`
-	Cores       float64 `json:"cores"`
-	Digest      string  `json:"digest"`
-	Memory      float64 `json:"memory"`
-	Net         map[string]QemuNet
-	SMBios1     string            `json:"smbios1"`
-	Sockets     float64           `json:"sockets"`
-	Disks       map[string]string `json:"disks"`
-	Description string            `json:"description"`
+type qemuStatusData struct {
+	CPU       flexFloat  `json:"cpu"`
+	CPUs      flexFloat  `json:"cpus"`
+	Mem       flexFloat  `json:"mem"`
+	MaxMem    flexFloat  `json:"maxmem"`
+	Disk      flexFloat  `json:"disk"`
+	MaxDisk   flexFloat  `json:"maxdisk"`
+	DiskWrite flexFloat  `json:"diskwrite"`
+	DiskRead  flexFloat  `json:"diskread"`
+	NetIn     flexFloat  `json:"netin"`
+	NetOut    flexFloat  `json:"netout"`
+	Uptime    flexFloat  `json:"uptime"`
+	QmpStatus flexString `json:"qmpstatus"`
+	Status    flexString `json:"status"`
+	Template  flexString `json:"template"`
 }
 
 type QemuStatus struct {
@@ -62,6 +107,10 @@ type QemuStatus struct {
 }
 
 func (qemu QemuVM) Delete() (map[string]interface{}, error) {
+	return qemu.DeleteCtx(context.Background())
+}
+
+func (qemu QemuVM) DeleteCtx(ctx context.Context) (map[string]interface{}, error) {
 	var target string
 	var data map[string]interface{}
 	var err error
@@ -69,128 +118,144 @@ func (qemu QemuVM) Delete() (map[string]interface{}, error) {
 	//fmt.Print("!QemuDelete ", qemu.VMId)
 
 	target = "nodes/" + qemu.Node.Node + "/qemu/" + strconv.FormatFloat(qemu.VMId, 'f', 0, 64)
-	data, err = qemu.Node.Proxmox.Delete(target)
+	data, err = doMap(ctx, qemu.Node.Proxmox, "DELETE", target, nil)
 	if err != nil {
 		return nil, err
 	}
 	return data, nil
 }
 
-func stringToMap(data string, itemSeparator string, kvSeparator string) map[string]string {
-	var result map[string]string
-
-	result = make(map[string]string)
-	list := strings.Split(data, itemSeparator)
-	for _, item := range list {
-		kv := strings.Split(item, kvSeparator)
-		result[kv[0]] = kv[1]
-	}
-	return result
+func (qemu QemuVM) Config() (QemuConfig, error) {
+	return qemu.ConfigCtx(context.Background())
 }
 
-func (qemu QemuVM) Config() (QemuConfig, error) {
+func (qemu QemuVM) ConfigCtx(ctx context.Context) (QemuConfig, error) {
 	var target string
-	var data map[string]interface{}
 	var results map[string]interface{}
 	var config QemuConfig
 	var err error
-	var description string
 
 	//fmt.Print("!QemuConfig ", qemu.VMId)
 
 	target = "nodes/" + qemu.Node.Node + "/qemu/" + strconv.FormatFloat(qemu.VMId, 'f', 0, 64) + "/config"
-	data, err = qemu.Node.Proxmox.Get(target)
-	results = data["data"].(map[string]interface{})
+	err = qemu.Node.Proxmox.Do(ctx, "GET", target, nil, &results)
 	if err != nil {
 		return config, err
 	}
-	if description, _ = results["description"].(string); err != nil {
-		return config, err
+	config = newQemuConfig(results)
+	return config, nil
+}
+
+func (qemu QemuVM) UpdateConfig(changes map[string]string, deletes []string, digest string) error {
+	return qemu.UpdateConfigCtx(context.Background(), changes, deletes, digest)
+}
+
+// UpdateConfigCtx sets the given configuration keys and removes the keys in
+// deletes. Pass the Digest of a previously read QemuConfig to reject the
+// change with an error matching ErrConfigModified if someone else changed the
+// configuration since, or an empty digest to update unconditionally.
+func (qemu QemuVM) UpdateConfigCtx(ctx context.Context, changes map[string]string, deletes []string, digest string) error {
+	var target string
+	var form url.Values
+	var err error
+
+	form, err = qemu.configForm(changes, deletes, digest)
+	if err != nil {
+		return err
 	}
-	config = QemuConfig{
-		Bootdisk:    results["bootdisk"].(string),
-		Cores:       results["cores"].(float64),
-		Digest:      results["digest"].(string),
-		Memory:      results["memory"].(float64),
-		Sockets:     results["sockets"].(float64),
-		SMBios1:     results["smbios1"].(string),
-		Description: description,
-	}
-
-	switch results["cores"].(type) {
-	default:
-		config.Cores = 1
-	case float64:
-		config.Cores = results["cores"].(float64)
-	}
-	switch results["sockets"].(type) {
-	default:
-		config.Sockets = 1
-	case float64:
-		config.Sockets = results["sockets"].(float64)
-	}
-	disktype := [4]string{"virtio", "sata", "ide", "scsi"}
-	disknum := [4]string{"0", "1", "2", "3"}
-	config.Disks = make(map[string]string)
-	for _, d := range disktype {
-		for _, i := range disknum {
-			id := d + i
-			if disk, ok := results[id]; ok {
-				config.Disks[id] = disk.(string)
-			}
-		}
+	target = "nodes/" + qemu.Node.Node + "/qemu/" + strconv.FormatFloat(qemu.VMId, 'f', 0, 64) + "/config"
+	return qemu.Node.Proxmox.Do(ctx, "PUT", target, form, nil)
+}
+
+func (qemu QemuVM) UpdateConfigAsync(changes map[string]string, deletes []string, digest string) (Task, error) {
+	return qemu.UpdateConfigAsyncCtx(context.Background(), changes, deletes, digest)
+}
+
+// UpdateConfigAsyncCtx works like UpdateConfigCtx, but returns the task
+// doing the update. Use it for changes which take long, e.g. allocating disks.
+func (qemu QemuVM) UpdateConfigAsyncCtx(ctx context.Context, changes map[string]string, deletes []string, digest string) (Task, error) {
+	var target string
+	var form url.Values
+	var err error
+	var UPid flexString
+
+	form, err = qemu.configForm(changes, deletes, digest)
+	if err != nil {
+		return Task{}, err
 	}
-	config.Net = make(map[string]QemuNet)
-	netnum := [4]string{"0", "1", "2", "3"}
-	for _, n := range netnum {
-		if net, ok := results["net"+n]; ok {
-			config.Net["net"+n] = stringToMap(net.(string), ",", "=")
-		}
+	target = "nodes/" + qemu.Node.Node + "/qemu/" + strconv.FormatFloat(qemu.VMId, 'f', 0, 64) + "/config"
+	err = qemu.Node.Proxmox.Do(ctx, "POST", target, form, &UPid)
+	if err != nil {
+		return Task{}, err
 	}
+	return Task{UPid: string(UPid), proxmox: qemu.Node.Proxmox}, nil
+}
 
-	return config, nil
+func (qemu QemuVM) configForm(changes map[string]string, deletes []string, digest string) (url.Values, error) {
+	var form url.Values
+
+	if len(changes) == 0 && len(deletes) == 0 {
+		return nil, errors.New("No configuration changes for VM " + strconv.FormatFloat(qemu.VMId, 'f', 0, 64) + ".")
+	}
+	form = url.Values{}
+	for k, v := range changes {
+		form.Set(k, v)
+	}
+	if len(deletes) > 0 {
+		form.Set("delete", strings.Join(deletes, ","))
+	}
+	if digest != "" {
+		form.Set("digest", digest)
+	}
+	return form, nil
 }
 
 func (qemu QemuVM) CurrentStatus() (QemuStatus, error) {
+	return qemu.CurrentStatusCtx(context.Background())
+}
+
+func (qemu QemuVM) CurrentStatusCtx(ctx context.Context) (QemuStatus, error) {
 	var target string
 	var err error
-	var data map[string]interface{}
-	var results map[string]interface{}
+	var results qemuStatusData
 	var status QemuStatus
 
 	//fmt.Println("!QemuStatus ", strconv.FormatFloat(qemu.VMId, 'f', 0, 64))
 
 	target = "nodes/" + qemu.Node.Node + "/qemu/" + strconv.FormatFloat(qemu.VMId, 'f', 0, 64) + "/status/current"
-	data, err = qemu.Node.Proxmox.Get(target)
+	err = qemu.Node.Proxmox.Do(ctx, "GET", target, nil, &results)
 	if err != nil {
 		return status, err
 	}
-	results = data["data"].(map[string]interface{})
 	status = QemuStatus{
-		CPU:       results["cpu"].(float64),
-		CPUs:      results["cpus"].(float64),
-		Mem:       results["mem"].(float64),
-		MaxMem:    results["maxmem"].(float64),
-		Disk:      results["disk"].(float64),
-		MaxDisk:   results["maxdisk"].(float64),
-		DiskWrite: results["diskwrite"].(float64),
-		DiskRead:  results["diskread"].(float64),
-		NetIn:     results["netin"].(float64),
-		NetOut:    results["netout"].(float64),
-		Uptime:    results["uptime"].(float64),
-		QmpStatus: results["qmpstatus"].(string),
-		Status:    results["status"].(string),
-		Template:  results["template"].(string),
+		CPU:       float64(results.CPU),
+		CPUs:      float64(results.CPUs),
+		Mem:       float64(results.Mem),
+		MaxMem:    float64(results.MaxMem),
+		Disk:      float64(results.Disk),
+		MaxDisk:   float64(results.MaxDisk),
+		DiskWrite: float64(results.DiskWrite),
+		DiskRead:  float64(results.DiskRead),
+		NetIn:     float64(results.NetIn),
+		NetOut:    float64(results.NetOut),
+		Uptime:    float64(results.Uptime),
+		QmpStatus: string(results.QmpStatus),
+		Status:    string(results.Status),
+		Template:  string(results.Template),
 	}
 	return status, nil
 }
 
 func (qemu QemuVM) WaitForStatus(status string, timeout int) error {
+	return qemu.WaitForStatusCtx(context.Background(), status, timeout)
+}
+
+func (qemu QemuVM) WaitForStatusCtx(ctx context.Context, status string, timeout int) error {
 	var i int
 	var err error
 	var qStatus QemuStatus
 	for i = 0; i < timeout; i++ {
-		qStatus, err = qemu.CurrentStatus()
+		qStatus, err = qemu.CurrentStatusCtx(ctx)
 		if err != nil {
 			return err
 		}
@@ -198,89 +263,120 @@ func (qemu QemuVM) WaitForStatus(status string, timeout int) error {
 		if qStatus.Status == status {
 			return nil
 		}
-		time.Sleep(time.Second * 1)
+		err = sleepCtx(ctx, time.Second*1)
+		if err != nil {
+			return err
+		}
 	}
 	return errors.New("Timeout reached")
 }
 
 func (qemu QemuVM) Start() error {
+	return qemu.StartCtx(context.Background())
+}
+
+func (qemu QemuVM) StartCtx(ctx context.Context) error {
 	var target string
 	var err error
 
 	//fmt.Println("!QemuStart ", strconv.FormatFloat(qemu.VMId, 'f', 0, 64))
 
 	target = "nodes/" + qemu.Node.Node + "/qemu/" + strconv.FormatFloat(qemu.VMId, 'f', 0, 64) + "/status/start"
-	_, err = qemu.Node.Proxmox.Post(target, "")
+	err = qemu.Node.Proxmox.Do(ctx, "POST", target, nil, nil)
 	return err
 }
 
 func (qemu QemuVM) Stop() (string, error) {
+	return qemu.StopCtx(context.Background())
+}
+
+func (qemu QemuVM) StopCtx(ctx context.Context) (string, error) {
 	var target string
 	var err error
+	var UPid flexString
 
 	//fmt.Print("!QemuStop ", qemu.VMId)
 
 	target = "nodes/" + qemu.Node.Node + "/qemu/" + strconv.FormatFloat(qemu.VMId, 'f', 0, 64) + "/status/stop"
-	data, err := qemu.Node.Proxmox.Post(target, "")
+	err = qemu.Node.Proxmox.Do(ctx, "POST", target, nil, &UPid)
 	if err != nil {
 		return "", err
 	}
 
-	UPid := data["data"].(string)
-
-	return UPid, nil
+	return string(UPid), nil
 }
 
 func (qemu QemuVM) Shutdown() (Task, error) {
+	return qemu.ShutdownCtx(context.Background())
+}
+
+func (qemu QemuVM) ShutdownCtx(ctx context.Context) (Task, error) {
 	var target string
 	var err error
+	var UPid flexString
 
 	//fmt.Print("!QemuShutdown ", qemu.VMId)
 
 	target = "nodes/" + qemu.Node.Node + "/qemu/" + strconv.FormatFloat(qemu.VMId, 'f', 0, 64) + "/status/shutdown"
-	data, err := qemu.Node.Proxmox.Post(target, "")
-
-	if err != err {
+	err = qemu.Node.Proxmox.Do(ctx, "POST", target, nil, &UPid)
+	if err != nil {
 		return Task{}, err
 	}
 
 	t := Task{
-		UPid:    data["data"].(string),
+		UPid:    string(UPid),
 		proxmox: qemu.Node.Proxmox,
 	}
 
-	return t, err
+	return t, nil
 }
 
 func (qemu QemuVM) Suspend() error {
+	return qemu.SuspendCtx(context.Background())
+}
+
+func (qemu QemuVM) SuspendCtx(ctx context.Context) error {
 	var target string
 	var err error
 
 	//fmt.Print("!QemuSuspend ", qemu.VMId)
 
 	target = "nodes/" + qemu.Node.Node + "/qemu/" + strconv.FormatFloat(qemu.VMId, 'f', 0, 64) + "/status/suspend"
-	_, err = qemu.Node.Proxmox.Post(target, "")
+	err = qemu.Node.Proxmox.Do(ctx, "POST", target, nil, nil)
 	return err
 }
 
 func (qemu QemuVM) Resume() error {
+	return qemu.ResumeCtx(context.Background())
+}
+
+func (qemu QemuVM) ResumeCtx(ctx context.Context) error {
 	var target string
 	var err error
 
 	//fmt.Print("!QemuResume ", qemu.VMId)
 
 	target = "nodes/" + qemu.Node.Node + "/qemu/" + strconv.FormatFloat(qemu.VMId, 'f', 0, 64) + "/status/resume"
-	_, err = qemu.Node.Proxmox.Post(target, "")
+	err = qemu.Node.Proxmox.Do(ctx, "POST", target, nil, nil)
 	return err
 }
 
 func (qemu QemuVM) Clone(newId float64, name string, targetName string) (Task, error) {
-	return qemu.CloneToPool(newId, name, targetName, "")
+	return qemu.CloneCtx(context.Background(), newId, name, targetName)
+}
+
+func (qemu QemuVM) CloneCtx(ctx context.Context, newId float64, name string, targetName string) (Task, error) {
+	return qemu.CloneToPoolCtx(ctx, newId, name, targetName, "")
 }
 
 func (qemu QemuVM) CloneToPool(newId float64, name string, targetName string, pool string) (Task, error) {
+	return qemu.CloneToPoolCtx(context.Background(), newId, name, targetName, pool)
+}
+
+func (qemu QemuVM) CloneToPoolCtx(ctx context.Context, newId float64, name string, targetName string, pool string) (Task, error) {
 	var target string
 	var err error
+	var UPid flexString
 
 	newVMID := strconv.FormatFloat(newId, 'f', 0, 64)
 
@@ -297,13 +393,13 @@ func (qemu QemuVM) CloneToPool(newId float64, name string, targetName string, po
 		form.Add("pool", pool)
 	}
 
-	data, err := qemu.Node.Proxmox.PostForm(target, form)
-	if err != err {
+	err = qemu.Node.Proxmox.Do(ctx, "POST", target, form, &UPid)
+	if err != nil {
 		return Task{}, err
 	}
 
 	t := Task{
-		UPid:    data["data"].(string),
+		UPid:    string(UPid),
 		proxmox: qemu.Node.Proxmox,
 	}
 
@@ -311,42 +407,26 @@ func (qemu QemuVM) CloneToPool(newId float64, name string, targetName string, po
 }
 
 func (qemu QemuVM) SetDescription(description string) error {
-	var target string
-	var err error
-
-	target = "nodes/" + qemu.Node.Node + "/qemu/" + strconv.FormatFloat(qemu.VMId, 'f', 0, 64) + "/config"
-
-	form := url.Values{
-		"description": {description},
-	}
-
-	_, err = qemu.Node.Proxmox.PutForm(target, form)
-	if err != err {
-		return err
-	}
+	return qemu.SetDescriptionCtx(context.Background(), description)
+}
 
-	return nil
+func (qemu QemuVM) SetDescriptionCtx(ctx context.Context, description string) error {
+	return qemu.UpdateConfigCtx(ctx, map[string]string{"description": description}, nil, "")
 }
 
 func (qemu QemuVM) SetMemory(memory string) error {
-	var target string
-	var err error
-
-	target = "nodes/" + qemu.Node.Node + "/qemu/" + strconv.FormatFloat(qemu.VMId, 'f', 0, 64) + "/config"
-
-	form := url.Values{
-		"memory": {memory},
-	}
-
-	_, err = qemu.Node.Proxmox.PutForm(target, form)
-	if err != err {
-		return err
-	}
+	return qemu.SetMemoryCtx(context.Background(), memory)
+}
 
-	return nil
+func (qemu QemuVM) SetMemoryCtx(ctx context.Context, memory string) error {
+	return qemu.UpdateConfigCtx(ctx, map[string]string{"memory": memory}, nil, "")
 }
 
 func (qemu QemuVM) SetIPSet(ip string) error {
+	return qemu.SetIPSetCtx(context.Background(), ip)
+}
+
+func (qemu QemuVM) SetIPSetCtx(ctx context.Context, ip string) error {
 	var target string
 	var err error
 
@@ -364,7 +444,7 @@ func (qemu QemuVM) SetIPSet(ip string) error {
 		"policy_out":    {"ACCEPT"},
 	}
 
-	_, err = qemu.Node.Proxmox.PutForm(target, form)
+	err = qemu.Node.Proxmox.Do(ctx, "PUT", target, form, nil)
 	if err != nil {
 		return err
 	}
@@ -375,7 +455,7 @@ func (qemu QemuVM) SetIPSet(ip string) error {
 		"name": {"ipfilter-net0"},
 	}
 
-	_, err = qemu.Node.Proxmox.PostForm(target, form)
+	err = qemu.Node.Proxmox.Do(ctx, "POST", target, form, nil)
 	if err != nil {
 		return err
 	}
@@ -386,12 +466,12 @@ func (qemu QemuVM) SetIPSet(ip string) error {
 		"cidr": {ip},
 	}
 
-	_, err = qemu.Node.Proxmox.PostForm(target, form)
+	err = qemu.Node.Proxmox.Do(ctx, "POST", target, form, nil)
 	if err != nil {
 		return err
 	}
 
-	config, err := qemu.Config()
+	config, err := qemu.ConfigCtx(ctx)
 	if err != nil {
 		return err
 	}
@@ -408,7 +488,7 @@ func (qemu QemuVM) SetIPSet(ip string) error {
 		"net0": {net + ",firewall=1"},
 	}
 
-	_, err = qemu.Node.Proxmox.PutForm(target, form)
+	err = qemu.Node.Proxmox.Do(ctx, "PUT", target, form, nil)
 	if err != nil {
 		return err
 	}
@@ -417,6 +497,10 @@ func (qemu QemuVM) SetIPSet(ip string) error {
 }
 
 func (qemu QemuVM) ResizeDisk(size string) error {
+	return qemu.ResizeDiskCtx(context.Background(), size)
+}
+
+func (qemu QemuVM) ResizeDiskCtx(ctx context.Context, size string) error {
 	var target string
 	var err error
 
@@ -427,46 +511,10 @@ func (qemu QemuVM) ResizeDisk(size string) error {
 		"size": {size + "G"},
 	}
 
-	_, err = qemu.Node.Proxmox.PutForm(target, form)
+	err = qemu.Node.Proxmox.Do(ctx, "PUT", target, form, nil)
 	if err != nil {
 		return err
 	}
 
 	return nil
 }
-
-func (qemu QemuVM) Snapshot(name string, includeRAM bool) (string, error) {
-	target := "nodes/" + qemu.Node.Node + "/qemu/" + strconv.FormatFloat(qemu.VMId, 'f', 0, 64) + "/snapshot"
-
-	vmstate := "0"
-	if includeRAM == true {
-		vmstate = "1"
-	}
-
-	form := url.Values{
-		"snapname": {name},
-		"vmstate":  {vmstate},
-	}
-
-	data, err := qemu.Node.Proxmox.PostForm(target, form)
-	if err != nil {
-		return "", err
-	}
-
-	UPid := data["data"].(string)
-
-	return UPid, nil
-}
-
-func (qemu QemuVM) Rollback(name string) (string, error) {
-	target := "nodes/" + qemu.Node.Node + "/qemu/" + strconv.FormatFloat(qemu.VMId, 'f', 0, 64) + "/snapshot/" + name + "/rollback"
-
-	data, err := qemu.Node.Proxmox.Post(target, "")
-	if err != nil {
-		return "", err
-	}
-
-	UPid := data["data"].(string)
-
-	return UPid, nil
-}
@@ -0,0 +1,247 @@
+package proxmox
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Index ranges of the numbered configuration keys, e.g. scsi0 to scsi30.
+var qemuDiskBuses = map[string]int{
+	"ide":    4,
+	"sata":   6,
+	"scsi":   31,
+	"virtio": 16,
+}
+
+const (
+	qemuMaxNet      = 32
+	qemuMaxHostPCI  = 16
+	qemuMaxUSB      = 14
+	qemuMaxSerial   = 4
+	qemuMaxIPConfig = 32
+)
+
+type QemuNet map[string]string
+
+// QemuOptions is a parsed property string like "host=0000:01:00,pcie=1".
+type QemuOptions map[string]string
+
+// QemuDisk is a parsed drive like "local-lvm:vm-100-disk-0,cache=none,size=32G".
+// Volume is "none" for an empty CD-ROM drive.
+type QemuDisk struct {
+	Volume  string
+	Size    string
+	Options QemuOptions
+}
+
+// Storage returns the storage part of the volume ID.
+func (disk QemuDisk) Storage() string {
+	if i := strings.Index(disk.Volume, ":"); i > 0 {
+		return disk.Volume[0:i]
+	}
+	return ""
+}
+
+func (disk QemuDisk) IsCDROM() bool {
+	return disk.Options["media"] == "cdrom"
+}
+
+// QemuConfig is the configuration of a VM. Disks, Net, HostPCI, USB, Serial
+// and IPConfig are keyed by their configuration key, e.g. "scsi0". Disks holds
+// the unparsed drive strings, DiskOptions the parsed ones. If Bootdisk is not
+// set, it is the first disk of the boot order which is not a CD-ROM. Raw
+// holds every key of the configuration as returned by the API, including
+// those without a typed field, e.g. "hookscript" or "unused0".
+type QemuConfig struct {
+	Bootdisk    string  `json:"bootdisk"`
+	Cores       float64 `json:"cores"`
+	Digest      string  `json:"digest"`
+	Memory      float64 `json:"memory"`
+	Net         map[string]QemuNet
+	SMBios1     string            `json:"smbios1"`
+	Sockets     float64           `json:"sockets"`
+	Disks       map[string]string `json:"disks"`
+	Description string            `json:"description"`
+	Name        string            `json:"name"`
+	Boot        string            `json:"boot"`
+	BootOrder   []string
+	CPU         string  `json:"cpu"`
+	Machine     string  `json:"machine"`
+	Bios        string  `json:"bios"`
+	SCSIHW      string  `json:"scsihw"`
+	OSType      string  `json:"ostype"`
+	Vga         string  `json:"vga"`
+	Balloon     float64 `json:"balloon"`
+	Numa        bool    `json:"numa"`
+	OnBoot      bool    `json:"onboot"`
+	Protection  bool    `json:"protection"`
+	Template    bool    `json:"template"`
+	Agent       QemuOptions
+	Tags        []string
+	EFIDisk0    *QemuDisk
+	TPMState0   *QemuDisk
+	DiskOptions map[string]QemuDisk
+	HostPCI     map[string]QemuOptions
+	USB         map[string]QemuOptions
+	Serial      map[string]string
+	IPConfig    map[string]QemuOptions
+	Raw         map[string]string
+}
+
+// AgentEnabled reports whether the QEMU guest agent is enabled.
+func (config QemuConfig) AgentEnabled() bool {
+	return config.Agent["enabled"] == "1"
+}
+
+// parseOptions parses a property string. A leading value without a key, as in
+// "1,fstrim_cloned_disks=1", is stored under defaultKey.
+func parseOptions(data string, defaultKey string) QemuOptions {
+	var result QemuOptions
+
+	result = make(QemuOptions)
+	if data == "" {
+		return result
+	}
+	for i, item := range strings.Split(data, ",") {
+		kv := strings.SplitN(item, "=", 2)
+		if len(kv) == 2 {
+			result[kv[0]] = kv[1]
+		} else if i == 0 && defaultKey != "" {
+			result[defaultKey] = item
+		} else {
+			result[item] = ""
+		}
+	}
+	return result
+}
+
+func parseDisk(data string) QemuDisk {
+	var disk QemuDisk
+
+	disk.Options = parseOptions(data, "file")
+	disk.Volume = disk.Options["file"]
+	disk.Size = disk.Options["size"]
+	delete(disk.Options, "file")
+	return disk
+}
+
+// parseTags splits the tag list, which the API separates by semicolons but
+// also accepts with commas or spaces.
+func parseTags(data string) []string {
+	return strings.FieldsFunc(data, func(r rune) bool {
+		return r == ';' || r == ',' || r == ' '
+	})
+}
+
+func newQemuConfig(results map[string]interface{}) QemuConfig {
+	var config QemuConfig
+	var id string
+
+	config = QemuConfig{
+		Bootdisk:    mapString(results, "bootdisk"),
+		Cores:       mapFloat(results, "cores"),
+		Digest:      mapString(results, "digest"),
+		Memory:      mapFloat(results, "memory"),
+		Sockets:     mapFloat(results, "sockets"),
+		SMBios1:     mapString(results, "smbios1"),
+		Description: mapString(results, "description"),
+		Name:        mapString(results, "name"),
+		Boot:        mapString(results, "boot"),
+		CPU:         mapString(results, "cpu"),
+		Machine:     mapString(results, "machine"),
+		Bios:        mapString(results, "bios"),
+		SCSIHW:      mapString(results, "scsihw"),
+		OSType:      mapString(results, "ostype"),
+		Vga:         mapString(results, "vga"),
+		Balloon:     mapFloat(results, "balloon"),
+		Numa:        mapFloat(results, "numa") != 0,
+		OnBoot:      mapFloat(results, "onboot") != 0,
+		Protection:  mapFloat(results, "protection") != 0,
+		Template:    mapFloat(results, "template") != 0,
+		Agent:       parseOptions(mapString(results, "agent"), "enabled"),
+		Tags:        parseTags(mapString(results, "tags")),
+		DiskOptions: make(map[string]QemuDisk),
+		Disks:       make(map[string]string),
+		Net:         make(map[string]QemuNet),
+		HostPCI:     make(map[string]QemuOptions),
+		USB:         make(map[string]QemuOptions),
+		Serial:      make(map[string]string),
+		IPConfig:    make(map[string]QemuOptions),
+		Raw:         make(map[string]string),
+	}
+	for k := range results {
+		config.Raw[k] = mapString(results, k)
+	}
+	if config.Cores == 0 {
+		config.Cores = 1
+	}
+	if config.Sockets == 0 {
+		config.Sockets = 1
+	}
+	if config.Bios == "" {
+		config.Bios = "seabios"
+	}
+	if efidisk, ok := results["efidisk0"].(string); ok {
+		disk := parseDisk(efidisk)
+		config.EFIDisk0 = &disk
+	}
+	if tpmstate, ok := results["tpmstate0"].(string); ok {
+		disk := parseDisk(tpmstate)
+		config.TPMState0 = &disk
+	}
+
+	for bus, count := range qemuDiskBuses {
+		for i := 0; i < count; i++ {
+			id = bus + strconv.Itoa(i)
+			if disk, ok := results[id].(string); ok {
+				config.Disks[id] = disk
+				config.DiskOptions[id] = parseDisk(disk)
+			}
+		}
+	}
+	for i := 0; i < qemuMaxNet; i++ {
+		id = "net" + strconv.Itoa(i)
+		if net, ok := results[id].(string); ok {
+			config.Net[id] = QemuNet(parseOptions(net, ""))
+		}
+	}
+	for i := 0; i < qemuMaxHostPCI; i++ {
+		id = "hostpci" + strconv.Itoa(i)
+		if hostpci, ok := results[id].(string); ok {
+			config.HostPCI[id] = parseOptions(hostpci, "host")
+		}
+	}
+	for i := 0; i < qemuMaxUSB; i++ {
+		id = "usb" + strconv.Itoa(i)
+		if usb, ok := results[id].(string); ok {
+			config.USB[id] = parseOptions(usb, "host")
+		}
+	}
+	for i := 0; i < qemuMaxSerial; i++ {
+		id = "serial" + strconv.Itoa(i)
+		if serial, ok := results[id].(string); ok {
+			config.Serial[id] = serial
+		}
+	}
+	for i := 0; i < qemuMaxIPConfig; i++ {
+		id = "ipconfig" + strconv.Itoa(i)
+		if ipconfig, ok := results[id].(string); ok {
+			config.IPConfig[id] = parseOptions(ipconfig, "")
+		}
+	}
+
+	// "order=scsi0;ide2;net0" since PVE 6.2, older configurations use legacy
+	// letters like "cdn" together with bootdisk.
+	if order, ok := parseOptions(config.Boot, "legacy")["order"]; ok {
+		config.BootOrder = strings.Split(order, ";")
+	}
+	if config.Bootdisk == "" {
+		for _, id = range config.BootOrder {
+			if disk, ok := config.DiskOptions[id]; ok && !disk.IsCDROM() {
+				config.Bootdisk = id
+				break
+			}
+		}
+	}
+	return config
+}
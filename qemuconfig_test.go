@@ -0,0 +1,135 @@
+package proxmox
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/joernott/go-proxmox/proxmoxtest"
+)
+
+func TestQemuConfig(t *testing.T) {
+	srv := newTestServer(t)
+	srv.AddVM(proxmoxtest.VM{VMID: 100, Name: "web", Config: map[string]string{
+		"cores":      "2",
+		"sockets":    "2",
+		"memory":     "4096",
+		"boot":       "order=ide2;scsi0;net0",
+		"agent":      "1,fstrim_cloned_disks=1",
+		"tags":       "prod;web",
+		"onboot":     "1",
+		"ide2":       "none,media=cdrom",
+		"sata1":      "local-lvm:vm-100-disk-2,size=8G",
+		"scsi0":      "local-lvm:vm-100-disk-0,cache=none,size=32G",
+		"virtio3":    "ceph:vm-100-disk-1,iothread=1,size=100G",
+		"efidisk0":   "local-lvm:vm-100-disk-3,efitype=4m,size=4M",
+		"net0":       "virtio=BC:24:11:00:00:01,bridge=vmbr0,firewall=1",
+		"hostpci0":   "0000:01:00,pcie=1",
+		"usb1":       "host=046d:c52b,usb3=1",
+		"serial0":    "socket",
+		"ipconfig0":  "ip=10.0.0.10/24,gw=10.0.0.1",
+		"hookscript": "local:snippets/hook.pl",
+		"unused0":    "local-lvm:vm-100-disk-9",
+	}})
+	proxmox := newTestClient(t, srv)
+	qemu, err := proxmox.FindVM("100")
+	if err != nil {
+		t.Fatalf("FindVM: %v", err)
+	}
+
+	config, err := qemu.Config()
+	if err != nil {
+		t.Fatalf("Config: %v", err)
+	}
+	if config.Name != "web" || config.Cores != 2 || config.Sockets != 2 || config.Memory != 4096 || !config.OnBoot {
+		t.Errorf("Config = %s %v cores %v sockets %v MiB onboot %v", config.Name, config.Cores, config.Sockets, config.Memory, config.OnBoot)
+	}
+	if config.Bios != "seabios" {
+		t.Errorf("Bios = %q, want the default seabios", config.Bios)
+	}
+	if !config.AgentEnabled() || config.Agent["fstrim_cloned_disks"] != "1" {
+		t.Errorf("Agent = %v", config.Agent)
+	}
+	if !reflect.DeepEqual(config.Tags, []string{"prod", "web"}) {
+		t.Errorf("Tags = %v", config.Tags)
+	}
+	if !reflect.DeepEqual(config.BootOrder, []string{"ide2", "scsi0", "net0"}) {
+		t.Errorf("BootOrder = %v", config.BootOrder)
+	}
+	// ide2 comes first, but is a CD-ROM.
+	if config.Bootdisk != "scsi0" {
+		t.Errorf("Bootdisk = %q, want scsi0", config.Bootdisk)
+	}
+
+	disks := map[string]QemuDisk{
+		"ide2":    {Volume: "none", Options: QemuOptions{"media": "cdrom"}},
+		"sata1":   {Volume: "local-lvm:vm-100-disk-2", Size: "8G", Options: QemuOptions{"size": "8G"}},
+		"scsi0":   {Volume: "local-lvm:vm-100-disk-0", Size: "32G", Options: QemuOptions{"cache": "none", "size": "32G"}},
+		"virtio3": {Volume: "ceph:vm-100-disk-1", Size: "100G", Options: QemuOptions{"iothread": "1", "size": "100G"}},
+	}
+	if !reflect.DeepEqual(config.DiskOptions, disks) {
+		t.Errorf("DiskOptions = %v, want %v", config.DiskOptions, disks)
+	}
+	if len(config.Disks) != 4 || config.Disks["scsi0"] != "local-lvm:vm-100-disk-0,cache=none,size=32G" {
+		t.Errorf("Disks = %v", config.Disks)
+	}
+	if !config.DiskOptions["ide2"].IsCDROM() || config.DiskOptions["virtio3"].Storage() != "ceph" {
+		t.Errorf("ide2 IsCDROM %v, virtio3 Storage %q", config.DiskOptions["ide2"].IsCDROM(), config.DiskOptions["virtio3"].Storage())
+	}
+	if config.EFIDisk0 == nil || config.EFIDisk0.Volume != "local-lvm:vm-100-disk-3" || config.EFIDisk0.Options["efitype"] != "4m" {
+		t.Errorf("EFIDisk0 = %v", config.EFIDisk0)
+	}
+	if config.TPMState0 != nil {
+		t.Errorf("TPMState0 = %v, want none", config.TPMState0)
+	}
+
+	net := map[string]QemuNet{"net0": {"virtio": "BC:24:11:00:00:01", "bridge": "vmbr0", "firewall": "1"}}
+	if !reflect.DeepEqual(config.Net, net) {
+		t.Errorf("Net = %v, want %v", config.Net, net)
+	}
+	hostpci := map[string]QemuOptions{"hostpci0": {"host": "0000:01:00", "pcie": "1"}}
+	if !reflect.DeepEqual(config.HostPCI, hostpci) {
+		t.Errorf("HostPCI = %v, want %v", config.HostPCI, hostpci)
+	}
+	usb := map[string]QemuOptions{"usb1": {"host": "046d:c52b", "usb3": "1"}}
+	if !reflect.DeepEqual(config.USB, usb) {
+		t.Errorf("USB = %v, want %v", config.USB, usb)
+	}
+	if !reflect.DeepEqual(config.Serial, map[string]string{"serial0": "socket"}) {
+		t.Errorf("Serial = %v", config.Serial)
+	}
+	ipconfig := map[string]QemuOptions{"ipconfig0": {"ip": "10.0.0.10/24", "gw": "10.0.0.1"}}
+	if !reflect.DeepEqual(config.IPConfig, ipconfig) {
+		t.Errorf("IPConfig = %v, want %v", config.IPConfig, ipconfig)
+	}
+
+	for _, key := range []string{"hookscript", "unused0", "scsi0", "cores", "name"} {
+		if _, ok := config.Raw[key]; !ok {
+			t.Errorf("Raw has no %s", key)
+		}
+	}
+	if config.Raw["hookscript"] != "local:snippets/hook.pl" || config.Raw["cores"] != "2" {
+		t.Errorf("Raw = %v", config.Raw)
+	}
+	if config.Raw["digest"] != config.Digest || config.Digest == "" {
+		t.Errorf("Digest = %q, Raw digest = %q", config.Digest, config.Raw["digest"])
+	}
+}
+
+func TestParseOptions(t *testing.T) {
+	tests := []struct {
+		data       string
+		defaultKey string
+		want       QemuOptions
+	}{
+		{data: "", defaultKey: "host", want: QemuOptions{}},
+		{data: "1", defaultKey: "enabled", want: QemuOptions{"enabled": "1"}},
+		{data: "enabled=0,type=virtio", defaultKey: "enabled", want: QemuOptions{"enabled": "0", "type": "virtio"}},
+		{data: "cdn", defaultKey: "legacy", want: QemuOptions{"legacy": "cdn"}},
+		{data: "ip=dhcp,ip6", defaultKey: "", want: QemuOptions{"ip": "dhcp", "ip6": ""}},
+	}
+	for _, tt := range tests {
+		if got := parseOptions(tt.data, tt.defaultKey); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseOptions(%q, %q) = %v, want %v", tt.data, tt.defaultKey, got, tt.want)
+		}
+	}
+}
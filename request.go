@@ -0,0 +1,162 @@
+package proxmox
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// request sends a request and returns the body of a successful response.
+// Any status other than 200 is returned as APIError.
+func (proxmox ProxMox) request(ctx context.Context, method string, endpoint string, body string, contentType string) ([]byte, error) {
+	r, err := proxmox.send(ctx, method, endpoint, body, contentType)
+	if err != nil {
+		proxmox.log().DebugContext(ctx, "Error while sending request", "method", method, "endpoint", endpoint, "error", err)
+		return nil, err
+	}
+	if r.StatusCode != 200 {
+		return nil, newAPIError(method, endpoint, r)
+	}
+	response, err := ioutil.ReadAll(r.Body)
+	r.Body.Close()
+	if err != nil {
+		proxmox.log().DebugContext(ctx, "Error while reading body", "method", method, "endpoint", endpoint, "error", err)
+		return nil, err
+	}
+	return response, nil
+}
+
+// Do is the common request pipeline. Parameters are sent as query string for
+// GET and DELETE and as form otherwise. The data member of the response is
+// decoded into out, which may be nil if the result is of no interest.
+func (proxmox ProxMox) Do(ctx context.Context, method string, endpoint string, params url.Values, out interface{}) error {
+	var body string
+	var contentType string
+	var envelope struct {
+		Data json.RawMessage `json:"data"`
+	}
+
+	if len(params) > 0 {
+		if method == "GET" || method == "DELETE" {
+			if strings.Contains(endpoint, "?") {
+				endpoint = endpoint + "&" + params.Encode()
+			} else {
+				endpoint = endpoint + "?" + params.Encode()
+			}
+		} else {
+			body = params.Encode()
+			contentType = "application/x-www-form-urlencoded"
+		}
+	}
+	response, err := proxmox.request(ctx, method, endpoint, body, contentType)
+	if err != nil {
+		return err
+	}
+	if out == nil {
+		return nil
+	}
+	err = json.Unmarshal(response, &envelope)
+	if err != nil {
+		proxmox.log().DebugContext(ctx, "Error while processing JSON", "method", method, "endpoint", endpoint, "error", err)
+		return err
+	}
+	if len(envelope.Data) == 0 || string(envelope.Data) == "null" {
+		return nil
+	}
+	err = json.Unmarshal(envelope.Data, out)
+	if err != nil {
+		proxmox.log().DebugContext(ctx, "Error while processing JSON", "method", method, "endpoint", endpoint, "error", err)
+	}
+	return err
+}
+
+// GetAs requests endpoint and decodes the data member of the response into a
+// value of type T. Members missing in the response or null keep their zero
+// value.
+func GetAs[T any](ctx context.Context, api Requester, endpoint string) (T, error) {
+	var result T
+
+	err := api.Do(ctx, "GET", endpoint, nil, &result)
+	return result, err
+}
+
+// doMap sends a request through api and returns the data member of the
+// response if it is an object, otherwise the data member wrapped as "data".
+func doMap(ctx context.Context, api Requester, method string, endpoint string, params url.Values) (map[string]interface{}, error) {
+	var data interface{}
+
+	err := api.Do(ctx, method, endpoint, params, &data)
+	if err != nil {
+		return nil, err
+	}
+	if m, ok := data.(map[string]interface{}); ok {
+		return m, nil
+	}
+	return map[string]interface{}{"data": data}, nil
+}
+
+// flexFloat decodes numbers the API sometimes sends as strings, e.g. vmid or
+// starttime. Booleans, which the guest agent uses, decode as 0 and 1. Null
+// and values that are no number decode as 0.
+type flexFloat float64
+
+func (f *flexFloat) UnmarshalJSON(b []byte) error {
+	var n float64
+
+	s := strings.Trim(string(b), `"`)
+	if s == "true" {
+		*f = 1
+		return nil
+	}
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		*f = 0
+		return nil
+	}
+	*f = flexFloat(n)
+	return nil
+}
+
+// flexString decodes strings the API sometimes sends as numbers.
+type flexString string
+
+func (f *flexString) UnmarshalJSON(b []byte) error {
+	var s string
+
+	if string(b) == "null" {
+		*f = ""
+		return nil
+	}
+	if err := json.Unmarshal(b, &s); err == nil {
+		*f = flexString(s)
+		return nil
+	}
+	*f = flexString(strings.Trim(string(b), `"`))
+	return nil
+}
+
+// mapString returns the string stored under key, numbers are formatted.
+func mapString(m map[string]interface{}, key string) string {
+	switch v := m[key].(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return ""
+}
+
+// mapFloat returns the number stored under key, strings are parsed.
+func mapFloat(m map[string]interface{}, key string) float64 {
+	switch v := m[key].(type) {
+	case float64:
+		return v
+	case string:
+		f, _ := strconv.ParseFloat(v, 64)
+		return f
+	}
+	return 0
+}
@@ -0,0 +1,94 @@
+package proxmox
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+)
+
+func TestFlexFloat(t *testing.T) {
+	tests := []struct {
+		json string
+		want flexFloat
+	}{
+		{json: `100`, want: 100},
+		{json: `"100"`, want: 100},
+		{json: `0.25`, want: 0.25},
+		{json: `"1.5e3"`, want: 1500},
+		{json: `true`, want: 1},
+		{json: `false`, want: 0},
+		{json: `null`, want: 0},
+		{json: `""`, want: 0},
+		{json: `"n/a"`, want: 0},
+	}
+	for _, tt := range tests {
+		var got flexFloat
+		if err := json.Unmarshal([]byte(tt.json), &got); err != nil {
+			t.Errorf("Unmarshal(%s): %v", tt.json, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Unmarshal(%s) = %v, want %v", tt.json, got, tt.want)
+		}
+	}
+}
+
+func TestFlexString(t *testing.T) {
+	tests := []struct {
+		json string
+		want flexString
+	}{
+		{json: `"pve"`, want: "pve"},
+		{json: `"a \"quoted\" name"`, want: `a "quoted" name`},
+		{json: `100`, want: "100"},
+		{json: `1.5`, want: "1.5"},
+		{json: `null`, want: ""},
+	}
+	for _, tt := range tests {
+		var got flexString
+		if err := json.Unmarshal([]byte(tt.json), &got); err != nil {
+			t.Errorf("Unmarshal(%s): %v", tt.json, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Unmarshal(%s) = %q, want %q", tt.json, got, tt.want)
+		}
+	}
+}
+
+func TestFlexTypesInStruct(t *testing.T) {
+	var data taskData
+
+	err := json.Unmarshal([]byte(`{"upid":"UPID:pve:1","pid":"4711","starttime":1700000000,"id":100,"endtime":null}`), &data)
+	if err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if data.PID != 4711 || data.StartTime != 1700000000 || data.ID != "100" || data.EndTime != 0 {
+		t.Errorf("taskData = %+v", data)
+	}
+}
+
+func TestGetAs(t *testing.T) {
+	s := newStubServer(t)
+	s.handleData("GET cluster/nextid", `"100"`)
+	proxmox := newStubClient(t, s)
+
+	version, err := GetAs[struct {
+		Version flexString `json:"version"`
+		Release flexString `json:"release"`
+	}](context.Background(), proxmox, "version")
+	if err != nil {
+		t.Fatalf("GetAs: %v", err)
+	}
+	if version.Version == "" || version.Release == "" {
+		t.Errorf("GetAs = %+v, want version and release", version)
+	}
+
+	nextID, err := GetAs[flexFloat](context.Background(), proxmox, "cluster/nextid")
+	if err != nil {
+		t.Fatalf("GetAs: %v", err)
+	}
+	if nextID != 100 {
+		t.Errorf("GetAs(cluster/nextid) = %v, want 100", nextID)
+	}
+}
@@ -0,0 +1,243 @@
+package proxmox
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Resource kinds accepted by Resources. ResourceAll returns everything,
+// including pools, which cannot be selected on their own.
+const (
+	ResourceAll     = ""
+	ResourceVM      = "vm"
+	ResourceStorage = "storage"
+	ResourceNode    = "node"
+	ResourceSDN     = "sdn"
+)
+
+// Resources is the inventory of the cluster as reported by cluster/resources.
+// Storages are listed once per node and keyed by "<node>/<storage>".
+type Resources struct {
+	Nodes      NodeList
+	VMs        QemuList
+	Containers ContainerList
+	Storages   StorageList
+	Pools      PoolList
+	SDNZones   SDNZoneList
+}
+
+type Container struct {
+	Mem       float64 `json:"mem"`
+	CPUs      float64 `json:"cpus"`
+	NetOut    float64 `json:"netout"`
+	Disk      float64 `json:"disk"`
+	MaxMem    float64 `json:"maxmem"`
+	Status    string  `json:"status"`
+	Template  float64 `json:"template"`
+	NetIn     float64 `json:"netin"`
+	MaxDisk   float64 `json:"maxdisk"`
+	Name      string  `json:"name"`
+	DiskWrite float64 `json:"diskwrite"`
+	CPU       float64 `json:"cpu"`
+	VMId      float64 `json:"vmid"`
+	DiskRead  float64 `json:"diskread"`
+	Uptime    float64 `json:"uptime"`
+	Pool      string  `json:"pool"`
+	Node      Node
+}
+
+type ContainerList map[string]Container
+
+type SDNZone struct {
+	SDN    string `json:"sdn"`
+	Status string `json:"status"`
+	Node   Node
+}
+
+// SDNZoneList is keyed by "<node>/<zone>".
+type SDNZoneList map[string]SDNZone
+
+type resourceData struct {
+	Id           flexString `json:"id"`
+	ResourceType flexString `json:"type"`
+	Node         flexString `json:"node"`
+	Status       flexString `json:"status"`
+	Name         flexString `json:"name"`
+	VMId         flexFloat  `json:"vmid"`
+	Pool         flexString `json:"pool"`
+	Template     flexFloat  `json:"template"`
+	CPU          flexFloat  `json:"cpu"`
+	MaxCPU       flexFloat  `json:"maxcpu"`
+	Mem          flexFloat  `json:"mem"`
+	MaxMem       flexFloat  `json:"maxmem"`
+	Disk         flexFloat  `json:"disk"`
+	MaxDisk      flexFloat  `json:"maxdisk"`
+	Uptime       *flexFloat `json:"uptime"`
+	NetIn        flexFloat  `json:"netin"`
+	NetOut       flexFloat  `json:"netout"`
+	DiskRead     flexFloat  `json:"diskread"`
+	DiskWrite    flexFloat  `json:"diskwrite"`
+	Level        flexString `json:"level"`
+	Storage      flexString `json:"storage"`
+	PluginType   flexString `json:"plugintype"`
+	Content      flexString `json:"content"`
+	Shared       flexFloat  `json:"shared"`
+	SDN          flexString `json:"sdn"`
+}
+
+func (v resourceData) uptime() float64 {
+	if v.Uptime == nil {
+		return 0
+	}
+	return float64(*v.Uptime)
+}
+
+func (v resourceData) node(api Requester) Node {
+	return Node{
+		Mem:      float64(v.Mem),
+		MaxDisk:  float64(v.MaxDisk),
+		Node:     string(v.Node),
+		MaxCPU:   float64(v.MaxCPU),
+		Uptime:   v.uptime(),
+		Id:       string(v.Id),
+		CPU:      float64(v.CPU),
+		Level:    string(v.Level),
+		NodeType: string(v.ResourceType),
+		Disk:     float64(v.Disk),
+		MaxMem:   float64(v.MaxMem),
+		Status:   string(v.Status),
+		Proxmox:  api,
+	}
+}
+
+func (v resourceData) qemu(node Node) QemuVM {
+	return QemuVM{
+		Mem:       float64(v.Mem),
+		CPUs:      float64(v.MaxCPU),
+		NetOut:    float64(v.NetOut),
+		Disk:      float64(v.Disk),
+		MaxMem:    float64(v.MaxMem),
+		Status:    string(v.Status),
+		Template:  float64(v.Template),
+		NetIn:     float64(v.NetIn),
+		MaxDisk:   float64(v.MaxDisk),
+		Name:      string(v.Name),
+		DiskWrite: float64(v.DiskWrite),
+		CPU:       float64(v.CPU),
+		VMId:      float64(v.VMId),
+		DiskRead:  float64(v.DiskRead),
+		Uptime:    v.uptime(),
+		Node:      node,
+	}
+}
+
+func (v resourceData) container(node Node) Container {
+	return Container{
+		Mem:       float64(v.Mem),
+		CPUs:      float64(v.MaxCPU),
+		NetOut:    float64(v.NetOut),
+		Disk:      float64(v.Disk),
+		MaxMem:    float64(v.MaxMem),
+		Status:    string(v.Status),
+		Template:  float64(v.Template),
+		NetIn:     float64(v.NetIn),
+		MaxDisk:   float64(v.MaxDisk),
+		Name:      string(v.Name),
+		DiskWrite: float64(v.DiskWrite),
+		CPU:       float64(v.CPU),
+		VMId:      float64(v.VMId),
+		DiskRead:  float64(v.DiskRead),
+		Uptime:    v.uptime(),
+		Pool:      string(v.Pool),
+		Node:      node,
+	}
+}
+
+// storage converts a storage resource. cluster/resources reports the used
+// and total space as disk and maxdisk.
+func (v resourceData) storage(node Node) Storage {
+	var active float64
+
+	if string(v.Status) == "available" {
+		active = 1
+	}
+	return Storage{
+		StorageType: string(v.PluginType),
+		Active:      active,
+		Total:       float64(v.MaxDisk),
+		Content:     string(v.Content),
+		Shared:      float64(v.Shared),
+		Storage:     string(v.Storage),
+		Used:        float64(v.Disk),
+		Avail:       float64(v.MaxDisk) - float64(v.Disk),
+		Node:        node,
+	}
+}
+
+func (proxmox ProxMox) Resources(kind string) (Resources, error) {
+	return proxmox.ResourcesCtx(context.Background(), kind)
+}
+
+// ResourcesCtx lists the resources of the given kind in the whole cluster
+// with a single request. Guests, storages and SDN zones refer to their node,
+// which is only filled in completely if nodes are part of the result.
+func (proxmox ProxMox) ResourcesCtx(ctx context.Context, kind string) (Resources, error) {
+	return clusterResources(ctx, proxmox, kind)
+}
+
+func clusterResources(ctx context.Context, api Requester, kind string) (Resources, error) {
+	var err error
+	var results []resourceData
+	var params url.Values
+	var resources Resources
+	var node Node
+	var ok bool
+
+	params = url.Values{}
+	if kind != ResourceAll {
+		params.Set("type", kind)
+	}
+	err = api.Do(ctx, "GET", "cluster/resources", params, &results)
+	if err != nil {
+		return resources, err
+	}
+
+	resources = Resources{
+		Nodes:      make(NodeList),
+		VMs:        make(QemuList),
+		Containers: make(ContainerList),
+		Storages:   make(StorageList),
+		Pools:      make(PoolList),
+		SDNZones:   make(SDNZoneList),
+	}
+	for _, v := range results {
+		if string(v.ResourceType) == "node" {
+			node = v.node(api)
+			resources.Nodes[node.Node] = node
+		}
+	}
+	for _, v := range results {
+		if node, ok = resources.Nodes[string(v.Node)]; !ok {
+			node = Node{Node: string(v.Node), Proxmox: api}
+		}
+		switch string(v.ResourceType) {
+		case "qemu":
+			resources.VMs[strconv.FormatFloat(float64(v.VMId), 'f', 0, 64)] = v.qemu(node)
+		case "lxc":
+			resources.Containers[strconv.FormatFloat(float64(v.VMId), 'f', 0, 64)] = v.container(node)
+		case "storage":
+			resources.Storages[node.Node+"/"+string(v.Storage)] = v.storage(node)
+		case "sdn":
+			resources.SDNZones[node.Node+"/"+string(v.SDN)] = SDNZone{SDN: string(v.SDN), Status: string(v.Status), Node: node}
+		case "pool":
+			id := string(v.Pool)
+			if id == "" {
+				id = strings.TrimPrefix(string(v.Id), "/pool/")
+			}
+			resources.Pools[id] = Pool{Poolid: id, proxmox: api}
+		}
+	}
+	return resources, nil
+}
@@ -0,0 +1,226 @@
+package proxmox
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultProtectMarker protects a snapshot from RetentionPolicy if it is
+// contained in its description.
+const DefaultProtectMarker = "[protect]"
+
+// RetentionPolicy selects the snapshots to keep, similar to the prune options
+// of vzdump. KeepLast keeps the newest snapshots, KeepHourly, KeepDaily,
+// KeepWeekly, KeepMonthly and KeepYearly the newest snapshot of as many
+// hours, days, ISO weeks, months and years. Like vzdump, the rules are
+// applied in this order and a period which already has a snapshot kept by
+// an earlier rule does not count again. Only snapshots whose name starts
+// with Prefix are considered, those with ProtectMarker in their description
+// are always kept. The periods are based on Location, the local time zone if
+// nil. Timeout is the number of seconds to wait for the deletion of one
+// snapshot, 300 if not set.
+type RetentionPolicy struct {
+	KeepLast      int
+	KeepHourly    int
+	KeepDaily     int
+	KeepWeekly    int
+	KeepMonthly   int
+	KeepYearly    int
+	Prefix        string
+	ProtectMarker string
+	Location      *time.Location
+	DryRun        bool
+	Timeout       int
+}
+
+// RetentionPlan lists the snapshots considered by a policy, newest first.
+type RetentionPlan struct {
+	Keep      []*QemuSnapshot
+	Delete    []*QemuSnapshot
+	Protected []*QemuSnapshot
+}
+
+// RetentionResult is the outcome of applying a policy to a VM. Deleted holds
+// the names of the snapshots actually deleted, which is less than planned
+// after an error or on a dry run.
+type RetentionResult struct {
+	VMId    string
+	Plan    RetentionPlan
+	Deleted []string
+	Error   error
+}
+
+// Plan decides which of the snapshots to keep. It fails if the policy has no
+// keep rule, which would delete all snapshots.
+func (policy RetentionPolicy) Plan(tree SnapshotTree) (RetentionPlan, error) {
+	var plan RetentionPlan
+	var candidates []*QemuSnapshot
+	var keep map[string]bool
+	var marker string
+	var location *time.Location
+
+	if policy.KeepLast <= 0 && policy.KeepHourly <= 0 && policy.KeepDaily <= 0 && policy.KeepWeekly <= 0 &&
+		policy.KeepMonthly <= 0 && policy.KeepYearly <= 0 {
+		return plan, errors.New("No retention rules given.")
+	}
+	marker = policy.ProtectMarker
+	if marker == "" {
+		marker = DefaultProtectMarker
+	}
+	location = policy.Location
+	if location == nil {
+		location = time.Local
+	}
+
+	for _, snapshot := range tree.Snapshots {
+		if !strings.HasPrefix(snapshot.Name, policy.Prefix) {
+			continue
+		}
+		candidates = append(candidates, snapshot)
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].SnapTime != candidates[j].SnapTime {
+			return candidates[i].SnapTime > candidates[j].SnapTime
+		}
+		return candidates[i].Name > candidates[j].Name
+	})
+
+	// Protected snapshots do not count against the keep rules.
+	for i := 0; i < len(candidates); i++ {
+		if strings.Contains(candidates[i].Description, marker) {
+			plan.Protected = append(plan.Protected, candidates[i])
+			candidates = append(candidates[:i], candidates[i+1:]...)
+			i--
+		}
+	}
+
+	keep = make(map[string]bool)
+	for i, snapshot := range candidates {
+		if i < policy.KeepLast {
+			keep[snapshot.Name] = true
+		}
+	}
+	keepPeriods(candidates, keep, policy.KeepHourly, func(t time.Time) string {
+		return t.Format("2006-01-02 15")
+	}, location)
+	keepPeriods(candidates, keep, policy.KeepDaily, func(t time.Time) string {
+		return t.Format("2006-01-02")
+	}, location)
+	keepPeriods(candidates, keep, policy.KeepWeekly, func(t time.Time) string {
+		year, week := t.ISOWeek()
+		return strconv.Itoa(year) + "/" + strconv.Itoa(week)
+	}, location)
+	keepPeriods(candidates, keep, policy.KeepMonthly, func(t time.Time) string {
+		return t.Format("2006-01")
+	}, location)
+	keepPeriods(candidates, keep, policy.KeepYearly, func(t time.Time) string {
+		return t.Format("2006")
+	}, location)
+
+	for _, snapshot := range candidates {
+		if keep[snapshot.Name] {
+			plan.Keep = append(plan.Keep, snapshot)
+		} else {
+			plan.Delete = append(plan.Delete, snapshot)
+		}
+	}
+	return plan, nil
+}
+
+// keepPeriods keeps the newest snapshot of the count newest periods which
+// have no snapshot kept already. candidates are sorted newest first.
+func keepPeriods(candidates []*QemuSnapshot, keep map[string]bool, count int, period func(time.Time) string, location *time.Location) {
+	var seen map[string]bool
+	var p string
+
+	if count <= 0 {
+		return
+	}
+	seen = make(map[string]bool)
+	for _, snapshot := range candidates {
+		if keep[snapshot.Name] {
+			seen[period(time.Unix(int64(snapshot.SnapTime), 0).In(location))] = true
+		}
+	}
+	for _, snapshot := range candidates {
+		if count == 0 {
+			return
+		}
+		if keep[snapshot.Name] {
+			continue
+		}
+		p = period(time.Unix(int64(snapshot.SnapTime), 0).In(location))
+		if seen[p] {
+			continue
+		}
+		seen[p] = true
+		keep[snapshot.Name] = true
+		count--
+	}
+}
+
+func (qemu QemuVM) ApplyRetention(policy RetentionPolicy) (RetentionResult, error) {
+	return qemu.ApplyRetentionCtx(context.Background(), policy)
+}
+
+// ApplyRetentionCtx deletes the snapshots not kept by the policy one after
+// the other, waiting for each deletion to finish. It stops at the first
+// error. With DryRun, only the plan is returned.
+func (qemu QemuVM) ApplyRetentionCtx(ctx context.Context, policy RetentionPolicy) (RetentionResult, error) {
+	var result RetentionResult
+	var tree SnapshotTree
+	var task Task
+	var exitStatus string
+	var err error
+
+	result.VMId = strconv.FormatFloat(qemu.VMId, 'f', 0, 64)
+	if policy.Timeout <= 0 {
+		policy.Timeout = 300
+	}
+	tree, err = qemu.SnapshotsCtx(ctx)
+	if err != nil {
+		return result, err
+	}
+	result.Plan, err = policy.Plan(tree)
+	if err != nil || policy.DryRun {
+		return result, err
+	}
+
+	for _, snapshot := range result.Plan.Delete {
+		task, err = qemu.DeleteSnapshotCtx(ctx, snapshot.Name, false)
+		if err != nil {
+			return result, err
+		}
+		exitStatus, err = task.WaitForStatusCtx(ctx, "stopped", policy.Timeout)
+		if err != nil {
+			return result, err
+		}
+		if exitStatus != "OK" {
+			return result, errors.New("Deleting snapshot " + snapshot.Name + " of VM " + result.VMId + " failed: " + exitStatus)
+		}
+		logger(qemu.Node.Proxmox).InfoContext(ctx, "Deleted snapshot", "vmid", result.VMId, "snapshot", snapshot.Name)
+		result.Deleted = append(result.Deleted, snapshot.Name)
+	}
+	return result, nil
+}
+
+func ApplyRetention(vms []QemuVM, policy RetentionPolicy) []RetentionResult {
+	return ApplyRetentionCtx(context.Background(), vms, policy)
+}
+
+// ApplyRetentionCtx applies the policy to the VMs one after the other. An
+// error for one VM is stored in its result and does not stop the others.
+func ApplyRetentionCtx(ctx context.Context, vms []QemuVM, policy RetentionPolicy) []RetentionResult {
+	var results []RetentionResult
+
+	for _, qemu := range vms {
+		result, err := qemu.ApplyRetentionCtx(ctx, policy)
+		result.Error = err
+		results = append(results, result)
+	}
+	return results
+}
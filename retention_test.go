@@ -0,0 +1,253 @@
+package proxmox
+
+import (
+	"testing"
+	"time"
+
+	"github.com/joernott/go-proxmox/proxmoxtest"
+)
+
+func snapshotNames(snapshots []*QemuSnapshot) []string {
+	var names []string
+
+	for _, snapshot := range snapshots {
+		names = append(names, snapshot.Name)
+	}
+	return names
+}
+
+// retentionTree returns snapshots taken at fixed times, newest first:
+//
+//	auto-a 2024-03-10 12:30 Sun, ISO week 10
+//	auto-p 2024-03-10 12:20 protected
+//	auto-b 2024-03-10 12:10
+//	auto-c 2024-03-10 09:00
+//	auto-d 2024-03-09 23:00
+//	auto-e 2024-03-04 10:00 Mon, ISO week 10
+//	auto-f 2024-02-25 10:00 ISO week 8
+//	auto-g 2024-02-01 10:00 ISO week 5
+//	auto-h 2023-12-31 10:00 ISO week 52 of 2023
+//	auto-i 2023-06-01 10:00
+//	auto-j 2022-06-01 10:00
+//
+// and manual, the newest one, which has another prefix.
+func retentionTree() SnapshotTree {
+	var tree SnapshotTree
+
+	snapshots := []struct {
+		name        string
+		description string
+		time        time.Time
+	}{
+		{"manual", "", time.Date(2024, 3, 10, 13, 0, 0, 0, time.UTC)},
+		{"auto-a", "", time.Date(2024, 3, 10, 12, 30, 0, 0, time.UTC)},
+		{"auto-p", "[protect] before upgrade", time.Date(2024, 3, 10, 12, 20, 0, 0, time.UTC)},
+		{"auto-b", "", time.Date(2024, 3, 10, 12, 10, 0, 0, time.UTC)},
+		{"auto-c", "", time.Date(2024, 3, 10, 9, 0, 0, 0, time.UTC)},
+		{"auto-d", "", time.Date(2024, 3, 9, 23, 0, 0, 0, time.UTC)},
+		{"auto-e", "", time.Date(2024, 3, 4, 10, 0, 0, 0, time.UTC)},
+		{"auto-f", "", time.Date(2024, 2, 25, 10, 0, 0, 0, time.UTC)},
+		{"auto-g", "", time.Date(2024, 2, 1, 10, 0, 0, 0, time.UTC)},
+		{"auto-h", "", time.Date(2023, 12, 31, 10, 0, 0, 0, time.UTC)},
+		{"auto-i", "", time.Date(2023, 6, 1, 10, 0, 0, 0, time.UTC)},
+		{"auto-j", "", time.Date(2022, 6, 1, 10, 0, 0, 0, time.UTC)},
+	}
+	tree.Snapshots = make(map[string]*QemuSnapshot)
+	for _, s := range snapshots {
+		tree.Snapshots[s.name] = &QemuSnapshot{Name: s.name, Description: s.description, SnapTime: float64(s.time.Unix())}
+	}
+	return tree
+}
+
+func TestRetentionPlan(t *testing.T) {
+	protected := []string{"auto-p"}
+	tests := []struct {
+		name          string
+		policy        RetentionPolicy
+		wantKeep      []string
+		wantDelete    []string
+		wantProtected []string
+	}{
+		{
+			name:          "keep last",
+			policy:        RetentionPolicy{KeepLast: 3, Prefix: "auto-"},
+			wantKeep:      []string{"auto-a", "auto-b", "auto-c"},
+			wantDelete:    []string{"auto-d", "auto-e", "auto-f", "auto-g", "auto-h", "auto-i", "auto-j"},
+			wantProtected: protected,
+		},
+		{
+			name:          "hourly",
+			policy:        RetentionPolicy{KeepHourly: 2, Prefix: "auto-"},
+			wantKeep:      []string{"auto-a", "auto-c"},
+			wantDelete:    []string{"auto-b", "auto-d", "auto-e", "auto-f", "auto-g", "auto-h", "auto-i", "auto-j"},
+			wantProtected: protected,
+		},
+		{
+			name:          "daily",
+			policy:        RetentionPolicy{KeepDaily: 3, Prefix: "auto-"},
+			wantKeep:      []string{"auto-a", "auto-d", "auto-e"},
+			wantDelete:    []string{"auto-b", "auto-c", "auto-f", "auto-g", "auto-h", "auto-i", "auto-j"},
+			wantProtected: protected,
+		},
+		{
+			name:          "weekly",
+			policy:        RetentionPolicy{KeepWeekly: 3, Prefix: "auto-"},
+			wantKeep:      []string{"auto-a", "auto-f", "auto-g"},
+			wantDelete:    []string{"auto-b", "auto-c", "auto-d", "auto-e", "auto-h", "auto-i", "auto-j"},
+			wantProtected: protected,
+		},
+		{
+			name:          "monthly",
+			policy:        RetentionPolicy{KeepMonthly: 3, Prefix: "auto-"},
+			wantKeep:      []string{"auto-a", "auto-f", "auto-h"},
+			wantDelete:    []string{"auto-b", "auto-c", "auto-d", "auto-e", "auto-g", "auto-i", "auto-j"},
+			wantProtected: protected,
+		},
+		{
+			name:          "yearly",
+			policy:        RetentionPolicy{KeepYearly: 5, Prefix: "auto-"},
+			wantKeep:      []string{"auto-a", "auto-h", "auto-j"},
+			wantDelete:    []string{"auto-b", "auto-c", "auto-d", "auto-e", "auto-f", "auto-g", "auto-i"},
+			wantProtected: protected,
+		},
+		{
+			name:          "more periods than snapshots",
+			policy:        RetentionPolicy{KeepDaily: 100, Prefix: "auto-"},
+			wantKeep:      []string{"auto-a", "auto-d", "auto-e", "auto-f", "auto-g", "auto-h", "auto-i", "auto-j"},
+			wantDelete:    []string{"auto-b", "auto-c"},
+			wantProtected: protected,
+		},
+		{
+			// The day of auto-a and auto-b is kept already, so daily goes on
+			// with the day before.
+			name:          "last and daily",
+			policy:        RetentionPolicy{KeepLast: 2, KeepDaily: 2, Prefix: "auto-"},
+			wantKeep:      []string{"auto-a", "auto-b", "auto-d", "auto-e"},
+			wantDelete:    []string{"auto-c", "auto-f", "auto-g", "auto-h", "auto-i", "auto-j"},
+			wantProtected: protected,
+		},
+		{
+			name:          "weekly, monthly and yearly",
+			policy:        RetentionPolicy{KeepWeekly: 1, KeepMonthly: 2, KeepYearly: 2, Prefix: "auto-"},
+			wantKeep:      []string{"auto-a", "auto-f", "auto-h", "auto-j"},
+			wantDelete:    []string{"auto-b", "auto-c", "auto-d", "auto-e", "auto-g", "auto-i"},
+			wantProtected: protected,
+		},
+		{
+			name:          "hourly, daily and weekly",
+			policy:        RetentionPolicy{KeepHourly: 1, KeepDaily: 1, KeepWeekly: 2, Prefix: "auto-"},
+			wantKeep:      []string{"auto-a", "auto-d", "auto-f", "auto-g"},
+			wantDelete:    []string{"auto-b", "auto-c", "auto-e", "auto-h", "auto-i", "auto-j"},
+			wantProtected: protected,
+		},
+		{
+			// In UTC+2, auto-d was taken on the same day as auto-a.
+			name:          "location",
+			policy:        RetentionPolicy{KeepDaily: 2, Prefix: "auto-", Location: time.FixedZone("UTC+2", 2*60*60)},
+			wantKeep:      []string{"auto-a", "auto-e"},
+			wantDelete:    []string{"auto-b", "auto-c", "auto-d", "auto-f", "auto-g", "auto-h", "auto-i", "auto-j"},
+			wantProtected: protected,
+		},
+		{
+			name:          "protect marker",
+			policy:        RetentionPolicy{KeepLast: 1, Prefix: "auto-", ProtectMarker: "upgrade"},
+			wantKeep:      []string{"auto-a"},
+			wantDelete:    []string{"auto-b", "auto-c", "auto-d", "auto-e", "auto-f", "auto-g", "auto-h", "auto-i", "auto-j"},
+			wantProtected: protected,
+		},
+		{
+			name:   "prefix matching nothing",
+			policy: RetentionPolicy{KeepLast: 2, Prefix: "nightly-"},
+		},
+		{
+			name:          "all snapshots",
+			policy:        RetentionPolicy{KeepYearly: 1},
+			wantKeep:      []string{"manual"},
+			wantDelete:    []string{"auto-a", "auto-b", "auto-c", "auto-d", "auto-e", "auto-f", "auto-g", "auto-h", "auto-i", "auto-j"},
+			wantProtected: protected,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy := tt.policy
+			if policy.Location == nil {
+				policy.Location = time.UTC
+			}
+			plan, err := policy.Plan(retentionTree())
+			if err != nil {
+				t.Fatalf("Plan: %v", err)
+			}
+			if got := snapshotNames(plan.Keep); !equalIDs(got, tt.wantKeep...) {
+				t.Errorf("Keep = %v, want %v", got, tt.wantKeep)
+			}
+			if got := snapshotNames(plan.Delete); !equalIDs(got, tt.wantDelete...) {
+				t.Errorf("Delete = %v, want %v", got, tt.wantDelete)
+			}
+			if got := snapshotNames(plan.Protected); !equalIDs(got, tt.wantProtected...) {
+				t.Errorf("Protected = %v, want %v", got, tt.wantProtected)
+			}
+		})
+	}
+}
+
+func TestRetentionPlanWithoutRules(t *testing.T) {
+	_, err := RetentionPolicy{Prefix: "auto-"}.Plan(retentionTree())
+	if err == nil {
+		t.Error("Plan without keep rules: got no error")
+	}
+}
+
+func TestApplyRetention(t *testing.T) {
+	srv := newTestServer(t)
+	srv.AddVM(proxmoxtest.VM{VMID: 100})
+	start := time.Date(2024, 3, 10, 0, 0, 0, 0, time.UTC)
+	for i, name := range []string{"auto-1", "auto-2", "auto-3", "auto-4"} {
+		srv.AddSnapshot(100, proxmoxtest.Snapshot{Name: name, SnapTime: start.Add(time.Duration(i) * time.Hour).Unix()})
+	}
+	proxmox := newTestClient(t, srv)
+	qemu, err := proxmox.FindVM("100")
+	if err != nil {
+		t.Fatalf("FindVM: %v", err)
+	}
+	remaining := func() []string {
+		fake, _ := srv.VM(100)
+		var names []string
+		for _, name := range []string{"auto-1", "auto-2", "auto-3", "auto-4"} {
+			if _, ok := fake.Snapshots[name]; ok {
+				names = append(names, name)
+			}
+		}
+		return names
+	}
+
+	// The fake lists the running state as "current", which is no snapshot.
+	policy := RetentionPolicy{KeepLast: 1, Location: time.UTC, DryRun: true}
+	result, err := qemu.ApplyRetention(policy)
+	if err != nil {
+		t.Fatalf("ApplyRetention with DryRun: %v", err)
+	}
+	if got := snapshotNames(result.Plan.Keep); !equalIDs(got, "auto-4") {
+		t.Errorf("Keep = %v, want [auto-4]", got)
+	}
+	if got := snapshotNames(result.Plan.Delete); !equalIDs(got, "auto-3", "auto-2", "auto-1") {
+		t.Errorf("Delete = %v, want [auto-3 auto-2 auto-1]", got)
+	}
+	if len(result.Deleted) != 0 {
+		t.Errorf("Deleted = %v with DryRun, want none", result.Deleted)
+	}
+	if got := remaining(); !equalIDs(got, "auto-1", "auto-2", "auto-3", "auto-4") {
+		t.Errorf("snapshots after DryRun = %v, want all four", got)
+	}
+
+	policy.DryRun = false
+	result, err = qemu.ApplyRetention(policy)
+	if err != nil {
+		t.Fatalf("ApplyRetention: %v", err)
+	}
+	if !equalIDs(result.Deleted, "auto-3", "auto-2", "auto-1") {
+		t.Errorf("Deleted = %v, want [auto-3 auto-2 auto-1]", result.Deleted)
+	}
+	if got := remaining(); !equalIDs(got, "auto-4") {
+		t.Errorf("snapshots left = %v, want [auto-4]", got)
+	}
+}
@@ -0,0 +1,125 @@
+package proxmox
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/rand"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// RetryPolicy controls how often and when a failed request is repeated.
+// Requests are retried after connection errors and on the configured status
+// codes, but only if their method is listed in Methods.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts, including the first one.
+	MaxAttempts int
+	// InitialBackoff is the wait before the first retry. It is multiplied by
+	// Multiplier for each further retry, up to MaxBackoff.
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	Multiplier     float64
+	// Jitter randomizes each wait by up to the given fraction, e.g. 0.2
+	// means +/- 20%.
+	Jitter float64
+	// StatusCodes lists the HTTP status codes considered transient. A 500
+	// with "got timeout" from pveproxy is always considered transient.
+	StatusCodes []int
+	// Methods lists the HTTP methods safe to repeat. Add POST, PUT or
+	// DELETE only if repeating those calls does no harm.
+	Methods []string
+}
+
+// DefaultRetryPolicy retries GET requests up to three times.
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:    4,
+		InitialBackoff: time.Millisecond * 500,
+		MaxBackoff:     time.Second * 10,
+		Multiplier:     2,
+		Jitter:         0.2,
+		StatusCodes:    []int{http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout, 596},
+		Methods:        []string{"GET"},
+	}
+}
+
+// WithRetry retries failed requests according to policy. Without it, every
+// request is sent only once.
+func WithRetry(policy RetryPolicy) Option {
+	return func(o *options) error {
+		if policy.MaxAttempts < 1 {
+			return errors.New("A retry policy needs at least one attempt.")
+		}
+		o.retry = &policy
+		return nil
+	}
+}
+
+func (policy RetryPolicy) allowsMethod(method string) bool {
+	for _, m := range policy.Methods {
+		if strings.EqualFold(m, method) {
+			return true
+		}
+	}
+	return false
+}
+
+// retryable tells whether a response or error is worth another attempt.
+func (policy RetryPolicy) retryable(r *http.Response, err error) bool {
+	if err != nil {
+		return !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded)
+	}
+	for _, code := range policy.StatusCodes {
+		if r.StatusCode == code {
+			return true
+		}
+	}
+	return r.StatusCode == http.StatusInternalServerError && strings.Contains(r.Status, "got timeout")
+}
+
+// backoff returns the wait before the given retry, counting from 1.
+func (policy RetryPolicy) backoff(retry int) time.Duration {
+	var d float64
+
+	multiplier := policy.Multiplier
+	if multiplier < 1 {
+		multiplier = 1
+	}
+	d = float64(policy.InitialBackoff) * math.Pow(multiplier, float64(retry-1))
+	if policy.MaxBackoff > 0 && d > float64(policy.MaxBackoff) {
+		d = float64(policy.MaxBackoff)
+	}
+	if policy.Jitter > 0 {
+		d = d * (1 + policy.Jitter*(2*rand.Float64()-1))
+	}
+	return time.Duration(d)
+}
+
+// send executes a request against the API and retries it according to the
+// retry policy.
+func (proxmox ProxMox) send(ctx context.Context, method string, endpoint string, body string, contentType string) (*http.Response, error) {
+	var err error
+	var r *http.Response
+	var attempt int
+
+	if proxmox.retry == nil || !proxmox.retry.allowsMethod(method) {
+		return proxmox.sendAuthenticated(ctx, method, endpoint, body, contentType)
+	}
+	for attempt = 1; ; attempt++ {
+		r, err = proxmox.sendAuthenticated(ctx, method, endpoint, body, contentType)
+		if attempt >= proxmox.retry.MaxAttempts || !proxmox.retry.retryable(r, err) {
+			return r, err
+		}
+		if err == nil {
+			r.Body.Close()
+		}
+		wait := proxmox.retry.backoff(attempt)
+		proxmox.log().DebugContext(ctx, "Retrying request", "method", method, "endpoint", endpoint,
+			"attempt", attempt+1, "wait", wait, "error", err)
+		if sleepErr := sleepCtx(ctx, wait); sleepErr != nil {
+			return nil, sleepErr
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package proxmox
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// flakyTransport answers the first failures requests to endpoint with status
+// 503 and passes everything else on.
+type flakyTransport struct {
+	transport http.RoundTripper
+	endpoint  string
+	failures  int
+
+	mu       sync.Mutex
+	attempts int
+}
+
+func (f *flakyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !strings.HasSuffix(req.URL.Path, "/api2/json/"+f.endpoint) {
+		return f.transport.RoundTrip(req)
+	}
+	f.mu.Lock()
+	f.attempts++
+	fail := f.attempts <= f.failures
+	f.mu.Unlock()
+	if fail {
+		return &http.Response{
+			StatusCode: http.StatusServiceUnavailable,
+			Status:     "503 Service Unavailable",
+			Body:       io.NopCloser(strings.NewReader("")),
+			Request:    req,
+		}, nil
+	}
+	return f.transport.RoundTrip(req)
+}
+
+func TestRetry(t *testing.T) {
+	policy := RetryPolicy{
+		MaxAttempts:    3,
+		InitialBackoff: time.Millisecond,
+		Multiplier:     2,
+		StatusCodes:    []int{http.StatusServiceUnavailable},
+		Methods:        []string{"GET"},
+	}
+	tests := []struct {
+		name         string
+		method       string
+		failures     int
+		wantAttempts int
+		wantErr      bool
+	}{
+		{name: "success after retries", method: "GET", failures: 2, wantAttempts: 3},
+		{name: "attempts exhausted", method: "GET", failures: 5, wantAttempts: 3, wantErr: true},
+		{name: "method not retried", method: "POST", failures: 1, wantAttempts: 1, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newStubServer(t)
+			s.handleData("GET pools", `[]`)
+			s.handleData("POST pools", `null`)
+			flaky := &flakyTransport{transport: s.Client().Transport, endpoint: "pools", failures: tt.failures}
+			proxmox, err := New(s.URL, WithPassword(stubUser, stubPassword), WithTransport(flaky), WithRetry(policy))
+			if err != nil {
+				t.Fatalf("New: %v", err)
+			}
+
+			if tt.method == "GET" {
+				_, err = proxmox.Pools()
+			} else {
+				_, err = proxmox.NewPool("test", "")
+			}
+			var apiErr *APIError
+			if tt.wantErr && !(errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusServiceUnavailable) {
+				t.Errorf("got error %v, want status 503", err)
+			}
+			if !tt.wantErr && err != nil {
+				t.Errorf("got error %v", err)
+			}
+			if flaky.attempts != tt.wantAttempts {
+				t.Errorf("%d attempts, want %d", flaky.attempts, tt.wantAttempts)
+			}
+		})
+	}
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	policy := RetryPolicy{
+		InitialBackoff: time.Millisecond * 100,
+		MaxBackoff:     time.Millisecond * 300,
+		Multiplier:     2,
+	}
+	for retry, want := range []time.Duration{100, 200, 300, 300} {
+		if got := policy.backoff(retry + 1); got != want*time.Millisecond {
+			t.Errorf("backoff(%d) = %v, want %v", retry+1, got, want*time.Millisecond)
+		}
+	}
+
+	policy.Jitter = 0.2
+	for i := 0; i < 100; i++ {
+		if got := policy.backoff(1); got < time.Millisecond*80 || got > time.Millisecond*120 {
+			t.Fatalf("backoff(1) with jitter = %v, want between 80ms and 120ms", got)
+		}
+	}
+}
+
+func TestRetryPolicyRetryable(t *testing.T) {
+	policy := DefaultRetryPolicy()
+	tests := []struct {
+		code   int
+		status string
+		want   bool
+	}{
+		{code: 502, status: "502 Bad Gateway", want: true},
+		{code: 596, status: "596 Broken pipe", want: true},
+		{code: 500, status: "500 got timeout", want: true},
+		{code: 500, status: "500 Internal Server Error", want: false},
+		{code: 401, status: "401 Unauthorized", want: false},
+	}
+	for _, tt := range tests {
+		r := &http.Response{StatusCode: tt.code, Status: tt.status}
+		if got := policy.retryable(r, nil); got != tt.want {
+			t.Errorf("retryable(%s) = %v, want %v", tt.status, got, tt.want)
+		}
+	}
+	if !policy.allowsMethod("get") || policy.allowsMethod("POST") {
+		t.Error("DefaultRetryPolicy should only retry GET")
+	}
+}
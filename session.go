@@ -0,0 +1,243 @@
+package proxmox
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// A PVEAuthCookie ticket is valid for two hours. It gets renewed well before
+// that, so that requests running at the time of the renewal still succeed.
+const (
+	ticketLifetime     = time.Hour * 2
+	ticketRenewalAfter = time.Hour * 1
+)
+
+// session holds the login ticket shared by all copies of a ProxMox value, so
+// that a renewal done through a Node or QemuVM is seen by everyone.
+type session struct {
+	renew  sync.Mutex
+	mu     sync.RWMutex
+	ticket string
+	csrf   string
+	issued time.Time
+}
+
+type ticketResult struct {
+	Data struct {
+		Ticket              string `json:"ticket"`
+		CSRFPreventionToken string `json:"CSRFPreventionToken"`
+	} `json:"data"`
+}
+
+func (s *session) get() (string, string, time.Time) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.ticket, s.csrf, s.issued
+}
+
+func (s *session) set(ticket string, csrf string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ticket = ticket
+	s.csrf = csrf
+	s.issued = time.Now()
+}
+
+// Ticket returns the login ticket currently in use. It differs from
+// ConnectionTicket once the ticket has been renewed.
+func (proxmox ProxMox) Ticket() string {
+	if proxmox.session == nil {
+		return proxmox.ConnectionTicket
+	}
+	ticket, _, _ := proxmox.session.get()
+	return ticket
+}
+
+// TicketIssued returns the time the current login ticket was issued.
+func (proxmox ProxMox) TicketIssued() time.Time {
+	if proxmox.session == nil {
+		return time.Time{}
+	}
+	_, _, issued := proxmox.session.get()
+	return issued
+}
+
+// login requests a new ticket with the given password, which may also be a
+// still valid ticket, and stores it in the session and the cookie jar.
+func (proxmox ProxMox) login(ctx context.Context, password string) error {
+	var err error
+	var form url.Values
+	var r *http.Response
+	var response []byte
+	var data ticketResult
+
+	form = url.Values{
+		"username": {proxmox.Username},
+		"password": {password},
+	}
+	r, err = proxmox.sendOnce(ctx, "POST", "access/ticket", form.Encode(), "application/x-www-form-urlencoded")
+	if err != nil {
+		return err
+	}
+	if r.StatusCode != 200 {
+		return newAPIError("POST", "access/ticket", r)
+	}
+	response, err = ioutil.ReadAll(r.Body)
+	r.Body.Close()
+	if err != nil {
+		return err
+	}
+	err = json.Unmarshal(response, &data)
+	if err != nil {
+		return err
+	}
+	if data.Data.Ticket == "" {
+		return errors.New("Login failed, no ticket received.")
+	}
+
+	proxmox.session.set(data.Data.Ticket, data.Data.CSRFPreventionToken)
+
+	cookieURL, err := url.Parse(proxmox.hostname() + "/")
+	if err != nil {
+		return err
+	}
+	proxmox.Client.Jar.SetCookies(cookieURL, []*http.Cookie{
+		{
+			Name:  "PVEAuthCookie",
+			Value: data.Data.Ticket,
+			Path:  "/",
+		},
+	})
+	return nil
+}
+
+// renewTicket renews the login ticket once it is older than
+// ticketRenewalAfter. The current ticket is used as password, if that fails
+// (e.g. because it already expired), the stored password is used. If force is
+// set, the ticket given as failed has been rejected by the server and a new
+// one is requested unless another request already did so.
+func (proxmox ProxMox) renewTicket(ctx context.Context, force bool, failed string) error {
+	var err error
+
+	if proxmox.session == nil || proxmox.apiToken != "" {
+		return nil
+	}
+	ticket, _, issued := proxmox.session.get()
+	if !force && time.Since(issued) < ticketRenewalAfter {
+		return nil
+	}
+
+	proxmox.session.renew.Lock()
+	defer proxmox.session.renew.Unlock()
+
+	ticket, _, issued = proxmox.session.get()
+	if force && ticket != failed {
+		return nil
+	}
+	if !force && time.Since(issued) < ticketRenewalAfter {
+		return nil
+	}
+	if !force && time.Since(issued) < ticketLifetime {
+		err = proxmox.login(ctx, ticket)
+		if err == nil {
+			return nil
+		}
+	}
+	return proxmox.login(ctx, proxmox.password)
+}
+
+// sendAuthenticated executes a request against the API. An expiring ticket
+// is renewed beforehand and a request rejected with 401 is retried once after
+// logging in again.
+func (proxmox ProxMox) sendAuthenticated(ctx context.Context, method string, endpoint string, body string, contentType string) (*http.Response, error) {
+	var err error
+	var r *http.Response
+	var ticket string
+
+	err = proxmox.renewTicket(ctx, false, "")
+	if err != nil {
+		return nil, err
+	}
+	if proxmox.session != nil {
+		ticket, _, _ = proxmox.session.get()
+	}
+	r, err = proxmox.sendFailover(ctx, method, endpoint, body, contentType)
+	if err != nil {
+		return nil, err
+	}
+	if r.StatusCode == http.StatusUnauthorized && proxmox.session != nil && proxmox.apiToken == "" {
+		r.Body.Close()
+		err = proxmox.renewTicket(ctx, true, ticket)
+		if err != nil {
+			return nil, err
+		}
+		r, err = proxmox.sendFailover(ctx, method, endpoint, body, contentType)
+	}
+	return r, err
+}
+
+// sendFailover sends a request and switches to another node if the current
+// one cannot be reached.
+func (proxmox ProxMox) sendFailover(ctx context.Context, method string, endpoint string, body string, contentType string) (*http.Response, error) {
+	var err error
+	var r *http.Response
+	var host string
+	var i int
+
+	for i = 0; ; i++ {
+		host = proxmox.hostname()
+		r, err = proxmox.sendOnce(ctx, method, endpoint, body, contentType)
+		if err == nil {
+			return r, nil
+		}
+		if proxmox.endpoints == nil || i >= len(proxmox.endpoints.hosts)-1 || !canFailover(method, err) {
+			return nil, err
+		}
+		if !proxmox.failover(ctx, host) {
+			return nil, err
+		}
+	}
+}
+
+func (proxmox ProxMox) sendOnce(ctx context.Context, method string, endpoint string, body string, contentType string) (*http.Response, error) {
+	var err error
+	var req *http.Request
+
+	if body != "" || method == "POST" || method == "PUT" {
+		req, err = http.NewRequestWithContext(ctx, method, proxmox.baseURL()+endpoint, bytes.NewBufferString(body))
+	} else {
+		req, err = http.NewRequestWithContext(ctx, method, proxmox.baseURL()+endpoint, nil)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Add("Content-Type", contentType)
+	}
+	if req.Body != nil {
+		req.Header.Add("Content-Length", strconv.Itoa(len(body)))
+	}
+	if proxmox.userAgent != "" {
+		req.Header.Set("User-Agent", proxmox.userAgent)
+	}
+	proxmox.authorize(req)
+
+	start := time.Now()
+	r, err := proxmox.Client.Do(req)
+	if err != nil {
+		proxmox.log().DebugContext(ctx, "Request failed", "method", method, "endpoint", endpoint,
+			"latency", time.Since(start), "error", err)
+		return nil, err
+	}
+	proxmox.log().DebugContext(ctx, "Request done", "method", method, "endpoint", endpoint,
+		"status", r.StatusCode, "latency", time.Since(start))
+	return r, nil
+}
@@ -0,0 +1,76 @@
+package proxmox
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestTicketRenewalAfterExpiry(t *testing.T) {
+	s := newStubServer(t)
+	proxmox := newStubClient(t, s)
+	first := proxmox.Ticket()
+
+	s.expireTickets()
+	if _, err := proxmox.Nodes(); err != nil {
+		t.Fatalf("Nodes after the ticket expired: %v", err)
+	}
+	if proxmox.Ticket() == first {
+		t.Error("Ticket() was not renewed after the server rejected it")
+	}
+
+	// Copies share the session, so a node sees the renewed ticket.
+	nodes, err := proxmox.Nodes()
+	if err != nil {
+		t.Fatalf("Nodes: %v", err)
+	}
+	for _, node := range nodes {
+		if node.Proxmox.(ProxMox).Ticket() != proxmox.Ticket() {
+			t.Errorf("node %s uses ticket %q, want %q", node.Node, node.Proxmox.(ProxMox).Ticket(), proxmox.Ticket())
+		}
+	}
+}
+
+func TestTicketRenewalConcurrent(t *testing.T) {
+	var wg sync.WaitGroup
+
+	s := newStubServer(t)
+	proxmox := newStubClient(t, s)
+
+	s.expireTickets()
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := proxmox.Nodes(); err != nil {
+				t.Errorf("Nodes: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.issued != 2 {
+		t.Errorf("%d tickets issued, want 2, one renewal for all requests", s.issued)
+	}
+}
+
+func TestTicketRenewalBeforeExpiry(t *testing.T) {
+	s := newStubServer(t)
+	proxmox := newStubClient(t, s)
+	first := proxmox.Ticket()
+
+	proxmox.session.mu.Lock()
+	proxmox.session.issued = time.Now().Add(-ticketRenewalAfter - time.Minute)
+	proxmox.session.mu.Unlock()
+
+	if _, err := proxmox.Nodes(); err != nil {
+		t.Fatalf("Nodes: %v", err)
+	}
+	if proxmox.Ticket() == first {
+		t.Error("Ticket() was not renewed after ticketRenewalAfter")
+	}
+	if time.Since(proxmox.TicketIssued()) > time.Minute {
+		t.Errorf("TicketIssued() = %v, want about now", proxmox.TicketIssued())
+	}
+}
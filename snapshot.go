@@ -0,0 +1,180 @@
+package proxmox
+
+import (
+	"context"
+	"net/url"
+	"sort"
+	"strconv"
+)
+
+// QemuSnapshot is a snapshot of a VM. SnapTime is the creation time in
+// seconds since the epoch, VMState tells whether the RAM was saved.
+type QemuSnapshot struct {
+	Name        string
+	Description string
+	Parent      string
+	SnapTime    float64
+	VMState     bool
+	Children    []*QemuSnapshot
+}
+
+// SnapshotTree holds the snapshots of a VM by name and as tree. Roots are the
+// snapshots without parent, Current is the snapshot the running state of
+// the VM is based on, empty if there is none.
+type SnapshotTree struct {
+	Snapshots map[string]*QemuSnapshot
+	Roots     []*QemuSnapshot
+	Current   string
+}
+
+type snapshotData struct {
+	Name        flexString `json:"name"`
+	Description flexString `json:"description"`
+	Parent      flexString `json:"parent"`
+	SnapTime    flexFloat  `json:"snaptime"`
+	VMState     flexFloat  `json:"vmstate"`
+}
+
+// sortSnapshots orders snapshots from oldest to newest.
+func sortSnapshots(snapshots []*QemuSnapshot) {
+	sort.Slice(snapshots, func(i, j int) bool {
+		if snapshots[i].SnapTime != snapshots[j].SnapTime {
+			return snapshots[i].SnapTime < snapshots[j].SnapTime
+		}
+		return snapshots[i].Name < snapshots[j].Name
+	})
+}
+
+func (qemu QemuVM) snapshotTarget(name string) string {
+	target := "nodes/" + qemu.Node.Node + "/qemu/" + strconv.FormatFloat(qemu.VMId, 'f', 0, 64) + "/snapshot"
+	if name != "" {
+		target = target + "/" + url.PathEscape(name)
+	}
+	return target
+}
+
+func (qemu QemuVM) Snapshots() (SnapshotTree, error) {
+	return qemu.SnapshotsCtx(context.Background())
+}
+
+func (qemu QemuVM) SnapshotsCtx(ctx context.Context) (SnapshotTree, error) {
+	var err error
+	var results []snapshotData
+	var tree SnapshotTree
+	var snapshot *QemuSnapshot
+
+	err = qemu.Node.Proxmox.Do(ctx, "GET", qemu.snapshotTarget(""), nil, &results)
+	if err != nil {
+		return tree, err
+	}
+
+	tree.Snapshots = make(map[string]*QemuSnapshot)
+	for _, v := range results {
+		// "current" is the running state of the VM, not a snapshot.
+		if string(v.Name) == "current" {
+			tree.Current = string(v.Parent)
+			continue
+		}
+		tree.Snapshots[string(v.Name)] = &QemuSnapshot{
+			Name:        string(v.Name),
+			Description: string(v.Description),
+			Parent:      string(v.Parent),
+			SnapTime:    float64(v.SnapTime),
+			VMState:     v.VMState != 0,
+		}
+	}
+	for _, snapshot = range tree.Snapshots {
+		if parent, ok := tree.Snapshots[snapshot.Parent]; ok {
+			parent.Children = append(parent.Children, snapshot)
+		} else {
+			tree.Roots = append(tree.Roots, snapshot)
+		}
+	}
+	for _, snapshot = range tree.Snapshots {
+		sortSnapshots(snapshot.Children)
+	}
+	sortSnapshots(tree.Roots)
+	return tree, nil
+}
+
+func (qemu QemuVM) Snapshot(name string, includeRAM bool) (Task, error) {
+	return qemu.SnapshotCtx(context.Background(), name, includeRAM)
+}
+
+func (qemu QemuVM) SnapshotCtx(ctx context.Context, name string, includeRAM bool) (Task, error) {
+	var form url.Values
+	var err error
+	var UPid flexString
+
+	form = url.Values{
+		"snapname": {name},
+		"vmstate":  {boolString(includeRAM)},
+	}
+	err = qemu.Node.Proxmox.Do(ctx, "POST", qemu.snapshotTarget(""), form, &UPid)
+	if err != nil {
+		return Task{}, err
+	}
+	return Task{UPid: string(UPid), ID: strconv.FormatFloat(qemu.VMId, 'f', 0, 64), proxmox: qemu.Node.Proxmox}, nil
+}
+
+func (qemu QemuVM) SnapshotConfig(name string) (QemuConfig, error) {
+	return qemu.SnapshotConfigCtx(context.Background(), name)
+}
+
+// SnapshotConfigCtx returns the configuration of the VM saved with the
+// snapshot.
+func (qemu QemuVM) SnapshotConfigCtx(ctx context.Context, name string) (QemuConfig, error) {
+	var results map[string]interface{}
+	var err error
+
+	err = qemu.Node.Proxmox.Do(ctx, "GET", qemu.snapshotTarget(name)+"/config", nil, &results)
+	if err != nil {
+		return QemuConfig{}, err
+	}
+	return newQemuConfig(results), nil
+}
+
+func (qemu QemuVM) UpdateSnapshot(name string, description string) error {
+	return qemu.UpdateSnapshotCtx(context.Background(), name, description)
+}
+
+// UpdateSnapshotCtx changes the description of the snapshot.
+func (qemu QemuVM) UpdateSnapshotCtx(ctx context.Context, name string, description string) error {
+	return qemu.Node.Proxmox.Do(ctx, "PUT", qemu.snapshotTarget(name)+"/config", url.Values{"description": {description}}, nil)
+}
+
+func (qemu QemuVM) DeleteSnapshot(name string, force bool) (Task, error) {
+	return qemu.DeleteSnapshotCtx(context.Background(), name, force)
+}
+
+// DeleteSnapshotCtx removes the snapshot. With force, the snapshot is removed
+// from the configuration even if deleting its disk snapshots fails.
+func (qemu QemuVM) DeleteSnapshotCtx(ctx context.Context, name string, force bool) (Task, error) {
+	var params url.Values
+	var err error
+	var UPid flexString
+
+	if force {
+		params = url.Values{"force": {"1"}}
+	}
+	err = qemu.Node.Proxmox.Do(ctx, "DELETE", qemu.snapshotTarget(name), params, &UPid)
+	if err != nil {
+		return Task{}, err
+	}
+	return Task{UPid: string(UPid), ID: strconv.FormatFloat(qemu.VMId, 'f', 0, 64), proxmox: qemu.Node.Proxmox}, nil
+}
+
+func (qemu QemuVM) Rollback(name string) (Task, error) {
+	return qemu.RollbackCtx(context.Background(), name)
+}
+
+func (qemu QemuVM) RollbackCtx(ctx context.Context, name string) (Task, error) {
+	var err error
+	var UPid flexString
+
+	err = qemu.Node.Proxmox.Do(ctx, "POST", qemu.snapshotTarget(name)+"/rollback", nil, &UPid)
+	if err != nil {
+		return Task{}, err
+	}
+	return Task{UPid: string(UPid), ID: strconv.FormatFloat(qemu.VMId, 'f', 0, 64), proxmox: qemu.Node.Proxmox}, nil
+}
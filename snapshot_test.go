@@ -0,0 +1,99 @@
+package proxmox
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/joernott/go-proxmox/proxmoxtest"
+)
+
+func TestSnapshots(t *testing.T) {
+	srv := newTestServer(t)
+	srv.AddVM(proxmoxtest.VM{VMID: 100, Config: map[string]string{"memory": "2048"}})
+	// base <- update <- current
+	//      <- test
+	srv.AddSnapshot(100, proxmoxtest.Snapshot{Name: "base", SnapTime: 1700000000})
+	srv.AddSnapshot(100, proxmoxtest.Snapshot{Name: "test", SnapTime: 1700000300, VMState: true, Description: "with RAM"})
+	srv.AddSnapshot(100, proxmoxtest.Snapshot{Name: "update", Parent: "base", SnapTime: 1700000200,
+		Config: map[string]string{"memory": "4096", "cores": "2"}})
+	proxmox := newTestClient(t, srv)
+	qemu, err := proxmox.FindVM("100")
+	if err != nil {
+		t.Fatalf("FindVM: %v", err)
+	}
+
+	tree, err := qemu.Snapshots()
+	if err != nil {
+		t.Fatalf("Snapshots: %v", err)
+	}
+	if tree.Current != "update" {
+		t.Errorf("Current = %q, want update", tree.Current)
+	}
+	if len(tree.Snapshots) != 3 {
+		t.Errorf("Snapshots = %v, want base, test and update", tree.Snapshots)
+	}
+	if got := snapshotNames(tree.Roots); !equalIDs(got, "base") {
+		t.Errorf("Roots = %v, want [base]", got)
+	}
+	// Children are ordered from oldest to newest.
+	if got := snapshotNames(tree.Snapshots["base"].Children); !equalIDs(got, "update", "test") {
+		t.Errorf("children of base = %v, want [update test]", got)
+	}
+	if test := tree.Snapshots["test"]; test.Parent != "base" || !test.VMState || test.Description != "with RAM" || test.SnapTime != 1700000300 {
+		t.Errorf("test = %+v", test)
+	}
+
+	config, err := qemu.SnapshotConfig("update")
+	if err != nil {
+		t.Fatalf("SnapshotConfig: %v", err)
+	}
+	if config.Memory != 4096 || config.Cores != 2 {
+		t.Errorf("SnapshotConfig = %v MiB, %v cores, want 4096 MiB, 2 cores", config.Memory, config.Cores)
+	}
+	if _, err = qemu.SnapshotConfig("nosuch"); err == nil {
+		t.Error("SnapshotConfig of a missing snapshot: got no error")
+	}
+
+	// Deleting base makes its children roots.
+	task, err := qemu.DeleteSnapshot("base", false)
+	if err != nil {
+		t.Fatalf("DeleteSnapshot: %v", err)
+	}
+	if _, err = task.WaitForStatus("stopped", 5); err != nil {
+		t.Fatalf("WaitForStatus: %v", err)
+	}
+	tree, err = qemu.Snapshots()
+	if err != nil {
+		t.Fatalf("Snapshots: %v", err)
+	}
+	if got := snapshotNames(tree.Roots); !equalIDs(got, "update", "test") {
+		t.Errorf("Roots after deleting base = %v, want [update test]", got)
+	}
+}
+
+func TestDeleteSnapshotForce(t *testing.T) {
+	var forced []string
+
+	s := newStubServer(t)
+	s.handle("DELETE nodes/pve/qemu/100/snapshot/before upgrade", func(w http.ResponseWriter, r *http.Request) {
+		forced = append(forced, r.URL.Query().Get("force"))
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"data":"UPID:pve:00001234:00005678:65F0A000:qmdelsnapshot:100:root@pam:"}`)
+	})
+	proxmox := newStubClient(t, s)
+	qemu := QemuVM{VMId: 100, Node: Node{Node: "pve", Proxmox: proxmox}}
+
+	for _, force := range []bool{false, true} {
+		task, err := qemu.DeleteSnapshot("before upgrade", force)
+		if err != nil {
+			t.Fatalf("DeleteSnapshot with force %v: %v", force, err)
+		}
+		if task.ID != "100" {
+			t.Errorf("task ID = %q, want 100", task.ID)
+		}
+	}
+	if !equalIDs(forced, "", "1") {
+		t.Errorf("force sent = %q, want none and then 1", forced)
+	}
+}
@@ -1,7 +1,7 @@
 package proxmox
 
 import (
-	"fmt"
+	"context"
 	"net/url"
 )
 
@@ -19,7 +19,45 @@ type Storage struct {
 
 type StorageList map[string]Storage
 
+type storageData struct {
+	StorageType flexString `json:"type"`
+	Active      flexFloat  `json:"active"`
+	Total       flexFloat  `json:"total"`
+	Content     flexString `json:"content"`
+	Shared      flexFloat  `json:"shared"`
+	Storage     flexString `json:"storage"`
+	Used        flexFloat  `json:"used"`
+	Avail       flexFloat  `json:"avail"`
+}
+
+func (v storageData) storage(node Node) Storage {
+	return Storage{
+		StorageType: string(v.StorageType),
+		Active:      float64(v.Active),
+		Total:       float64(v.Total),
+		Content:     string(v.Content),
+		Shared:      float64(v.Shared),
+		Storage:     string(v.Storage),
+		Used:        float64(v.Used),
+		Avail:       float64(v.Avail),
+		Node:        node,
+	}
+}
+
+type volumeData struct {
+	Size    flexFloat  `json:"size"`
+	VolId   flexString `json:"volid"`
+	VmId    flexString `json:"vmid"`
+	Format  flexString `json:"format"`
+	Content flexString `json:"content"`
+	Used    flexFloat  `json:"used"`
+}
+
 func (storage Storage) CreateVolume(FileName string, DiskSize string, VmId string) (map[string]interface{}, error) {
+	return storage.CreateVolumeCtx(context.Background(), FileName, DiskSize, VmId)
+}
+
+func (storage Storage) CreateVolumeCtx(ctx context.Context, FileName string, DiskSize string, VmId string) (map[string]interface{}, error) {
 	var form url.Values
 	var err error
 	var data map[string]interface{}
@@ -36,9 +74,9 @@ func (storage Storage) CreateVolume(FileName string, DiskSize string, VmId strin
 	}
 
 	target = "nodes/" + storage.Node.Node + "/storage/" + storage.Storage + "/content"
-	data, err = storage.Node.Proxmox.PostForm(target, form)
+	data, err = doMap(ctx, storage.Node.Proxmox, "POST", target, form)
 	if err != nil {
-		fmt.Println("Error!!!")
+		logger(storage.Node.Proxmox).DebugContext(ctx, "Error creating volume", "storage", storage.Storage, "filename", FileName, "error", err)
 		return nil, err
 	}
 	//fmt.Println("Storage created")
@@ -46,32 +84,33 @@ func (storage Storage) CreateVolume(FileName string, DiskSize string, VmId strin
 }
 
 func (storage Storage) Volumes() (VolumeList, error) {
+	return storage.VolumesCtx(context.Background())
+}
+
+func (storage Storage) VolumesCtx(ctx context.Context) (VolumeList, error) {
 	var err error
 	var target string
-	var data map[string]interface{}
 	var list VolumeList
 	var volume Volume
-	var results []interface{}
+	var results []volumeData
 
 	//fmt.Println("!Volumes")
 
 	target = "nodes/" + storage.Node.Node + "/storage/" + storage.Storage + "/content"
-	data, err = storage.Node.Proxmox.Get(target)
+	err = storage.Node.Proxmox.Do(ctx, "GET", target, nil, &results)
 	if err != nil {
 		return nil, err
 	}
 
 	list = make(VolumeList)
-	results = data["data"].([]interface{})
-	for _, v0 := range results {
-		v := v0.(map[string]interface{})
+	for _, v := range results {
 		volume = Volume{
-			Size:    v["size"].(float64),
-			VolId:   v["volid"].(string),
-			VmId:    v["vmid"].(string),
-			Format:  v["format"].(string),
-			Content: v["content"].(string),
-			Used:    v["used"].(float64),
+			Size:    float64(v.Size),
+			VolId:   string(v.VolId),
+			VmId:    string(v.VmId),
+			Format:  string(v.Format),
+			Content: string(v.Content),
+			Used:    float64(v.Used),
 			storage: storage,
 		}
 		list[volume.VolId] = volume
@@ -1,8 +1,11 @@
 package proxmox
 
 import (
-	"encoding/json"
+	"context"
 	"errors"
+	"io"
+	"net/url"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -17,7 +20,7 @@ type Task struct {
 	StartTime  float64 `json:"starttime"`
 	EndTime    float64 `json:"endtime"`
 	ID         string  `json:"id"`
-	proxmox    ProxMox
+	proxmox    Requester
 }
 
 type TaskList map[string]Task
@@ -26,40 +29,204 @@ type TaskResult struct {
 	Data Task `json:"data"`
 }
 
+// taskData is a task as sent by the API, which is not consistent about the
+// types of its numeric members.
+type taskData struct {
+	UPid       flexString `json:"upid"`
+	Type       flexString `json:"type"`
+	Status     flexString `json:"status"`
+	ExitStatus flexString `json:"exitstatus"`
+	PID        flexFloat  `json:"pid"`
+	PStart     flexFloat  `json:"pstart"`
+	StartTime  flexFloat  `json:"starttime"`
+	EndTime    flexFloat  `json:"endtime"`
+	ID         flexString `json:"id"`
+}
+
+func (v taskData) task(api Requester) Task {
+	return Task{
+		UPid:       string(v.UPid),
+		Type:       string(v.Type),
+		Status:     string(v.Status),
+		ExitStatus: string(v.ExitStatus),
+		PID:        float64(v.PID),
+		PStart:     float64(v.PStart),
+		StartTime:  float64(v.StartTime),
+		EndTime:    float64(v.EndTime),
+		ID:         string(v.ID),
+		proxmox:    api,
+	}
+}
+
 func (task Task) GetStatus() (string, string, error) {
+	return task.GetStatusCtx(context.Background())
+}
+
+func (task Task) GetStatusCtx(ctx context.Context) (string, string, error) {
 	var target string
 	var err error
-	var raw []byte
-	var data TaskResult
+	var node string
+	var data taskData
 
-	upidParts := strings.Split(task.UPid, ":")
-	target = "nodes/" + upidParts[1] + "/tasks/" + task.UPid + "/status"
-	//fmt.Println("target  " + target)
-	raw, err = task.proxmox.GetBytes(target)
+	node, err = task.node()
 	if err != nil {
 		return "", "", err
 	}
-	err = json.Unmarshal(raw, &data)
+	target = "nodes/" + node + "/tasks/" + task.UPid + "/status"
+	//fmt.Println("target  " + target)
+	err = task.proxmox.Do(ctx, "GET", target, nil, &data)
 	if err != nil {
 		return "", "", err
 	}
-	return data.Data.Status, data.Data.ExitStatus, nil
+	return string(data.Status), string(data.ExitStatus), nil
+}
+
+// node returns the node a task runs on, which is the second field of the
+// UPID (UPID:node:pid:pstart:starttime:type:id:user:).
+func (task Task) node() (string, error) {
+	upidParts := strings.Split(task.UPid, ":")
+	if len(upidParts) < 3 || upidParts[1] == "" {
+		return "", errors.New("Invalid UPID " + task.UPid + ".")
+	}
+	return upidParts[1], nil
 }
 
 func (task Task) WaitForStatus(status string, timeout int) (string, error) {
+	return task.WaitForStatusCtx(context.Background(), status, timeout)
+}
+
+func (task Task) WaitForStatusCtx(ctx context.Context, status string, timeout int) (string, error) {
 	var i int
 	var err error
 	var actstatus string
 	var exitstatus string
 	for i = 0; i < timeout; i++ {
-		actstatus, exitstatus, err = task.GetStatus()
+		actstatus, exitstatus, err = task.GetStatusCtx(ctx)
 		if err != nil {
 			return "", err
 		}
 		if actstatus == status {
 			return exitstatus, nil
 		}
-		time.Sleep(time.Second * 1)
+		err = sleepCtx(ctx, time.Second*1)
+		if err != nil {
+			return "", err
+		}
 	}
 	return "", errors.New("Timeout reached")
 }
+
+// TaskLogLine is a line of a task log. N is the line number starting at 1.
+type TaskLogLine struct {
+	N    int
+	Text string
+}
+
+type taskLogLineData struct {
+	N    flexFloat  `json:"n"`
+	Text flexString `json:"t"`
+}
+
+func (task Task) Log(start int, limit int) ([]TaskLogLine, error) {
+	return task.LogCtx(context.Background(), start, limit)
+}
+
+// LogCtx returns up to limit lines of the task log, skipping the first start
+// lines. A limit of 0 uses the default of the API, which is 50.
+func (task Task) LogCtx(ctx context.Context, start int, limit int) ([]TaskLogLine, error) {
+	var err error
+	var node string
+	var params url.Values
+	var results []taskLogLineData
+	var lines []TaskLogLine
+
+	node, err = task.node()
+	if err != nil {
+		return nil, err
+	}
+	params = url.Values{}
+	if start > 0 {
+		params.Set("start", strconv.Itoa(start))
+	}
+	if limit > 0 {
+		params.Set("limit", strconv.Itoa(limit))
+	}
+	err = task.proxmox.Do(ctx, "GET", "nodes/"+node+"/tasks/"+task.UPid+"/log", params, &results)
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range results {
+		lines = append(lines, TaskLogLine{N: int(v.N), Text: string(v.Text)})
+	}
+	return lines, nil
+}
+
+// Follow writes the task log to w as it grows until the task has stopped. It
+// returns an error unless the task ended with exit status "OK" or
+// "WARNINGS: n". The warnings themselves are part of the log written to w.
+func (task Task) Follow(ctx context.Context, w io.Writer) error {
+	var err error
+	var lines []TaskLogLine
+	var status string
+	var exitStatus string
+	var start int
+	var stopped bool
+
+	const limit = 500
+	for {
+		// Read the rest of the log after the task stopped, so the final
+		// lines are not missed.
+		if !stopped {
+			status, exitStatus, err = task.GetStatusCtx(ctx)
+			if err != nil {
+				return err
+			}
+			stopped = status == "stopped"
+		}
+		lines, err = task.LogCtx(ctx, start, limit)
+		if err != nil {
+			return err
+		}
+		// The API answers a page without lines with a "no content"
+		// placeholder numbered 1.
+		if len(lines) == 1 && lines[0].N == 1 && lines[0].Text == "no content" {
+			lines = nil
+		}
+		for _, line := range lines {
+			if line.N <= start {
+				continue
+			}
+			_, err = io.WriteString(w, line.Text+"\n")
+			if err != nil {
+				return err
+			}
+			start = line.N
+		}
+		if len(lines) == limit {
+			continue
+		}
+		if stopped {
+			break
+		}
+		err = sleepCtx(ctx, time.Second*1)
+		if err != nil {
+			return err
+		}
+	}
+	if exitStatus != "OK" && !strings.HasPrefix(exitStatus, "WARNINGS:") {
+		return errors.New("Task " + task.UPid + " failed: " + exitStatus)
+	}
+	return nil
+}
+
+// sleepCtx waits for the given duration or until the context is done.
+func sleepCtx(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
@@ -0,0 +1,114 @@
+package proxmox
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/joernott/go-proxmox/proxmoxtest"
+)
+
+// newTestTask starts a snapshot task on the fake and gives it the log lines.
+func newTestTask(t *testing.T, srv *proxmoxtest.Server, lines ...string) Task {
+	t.Helper()
+	if _, ok := srv.VM(100); !ok {
+		srv.AddVM(proxmoxtest.VM{VMID: 100})
+	}
+	proxmox := newTestClient(t, srv)
+	qemu, err := proxmox.FindVM("100")
+	if err != nil {
+		t.Fatalf("FindVM: %v", err)
+	}
+	task, err := qemu.Snapshot("test", false)
+	if err != nil {
+		t.Fatalf("Snapshot: %v", err)
+	}
+	srv.SetTaskLog(task.UPid, lines...)
+	return task
+}
+
+func TestTaskLog(t *testing.T) {
+	srv := newTestServer(t)
+	task := newTestTask(t, srv, "line 1", "line 2", "line 3", "line 4", "line 5")
+
+	tests := []struct {
+		start int
+		limit int
+		want  []TaskLogLine
+	}{
+		{start: 0, limit: 2, want: []TaskLogLine{{1, "line 1"}, {2, "line 2"}}},
+		{start: 2, limit: 2, want: []TaskLogLine{{3, "line 3"}, {4, "line 4"}}},
+		{start: 4, limit: 0, want: []TaskLogLine{{5, "line 5"}, {6, "TASK OK"}}},
+		{start: 6, limit: 2, want: []TaskLogLine{{1, "no content"}}},
+	}
+	for _, tt := range tests {
+		lines, err := task.Log(tt.start, tt.limit)
+		if err != nil {
+			t.Fatalf("Log(%d, %d): %v", tt.start, tt.limit, err)
+		}
+		if len(lines) != len(tt.want) {
+			t.Errorf("Log(%d, %d) = %v, want %v", tt.start, tt.limit, lines, tt.want)
+			continue
+		}
+		for i := range lines {
+			if lines[i] != tt.want[i] {
+				t.Errorf("Log(%d, %d) = %v, want %v", tt.start, tt.limit, lines, tt.want)
+				break
+			}
+		}
+	}
+}
+
+func TestFollow(t *testing.T) {
+	tests := []struct {
+		name       string
+		duration   time.Duration
+		lines      []string
+		exitStatus string
+		want       string
+		wantErr    bool
+	}{
+		{name: "finished", lines: []string{"saving state", "done"}, want: "saving state\ndone\nTASK OK\n"},
+		{name: "empty log", want: "TASK OK\n"},
+		{name: "running", duration: time.Millisecond * 1500, lines: []string{"line 1", "line 2", "line 3"},
+			want: "line 1\nline 2\nline 3\nTASK OK\n"},
+		{name: "warnings", lines: []string{"WARN: disk is almost full"}, exitStatus: "WARNINGS: 1",
+			want: "WARN: disk is almost full\nTASK ERROR: WARNINGS: 1\n"},
+		{name: "failed", lines: []string{"snapshot feature is not available"}, exitStatus: "snapshot failed",
+			want: "snapshot feature is not available\nTASK ERROR: snapshot failed\n", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out strings.Builder
+
+			srv := newTestServer(t)
+			srv.TaskDuration = tt.duration
+			task := newTestTask(t, srv, tt.lines...)
+			if tt.exitStatus != "" {
+				srv.FailTask(task.UPid, tt.exitStatus)
+			}
+
+			err := task.Follow(context.Background(), &out)
+			if tt.wantErr != (err != nil) {
+				t.Errorf("Follow: got error %v, want error %v", err, tt.wantErr)
+			}
+			if out.String() != tt.want {
+				t.Errorf("Follow wrote %q, want %q", out.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestFollowCancelled(t *testing.T) {
+	srv := newTestServer(t)
+	srv.TaskDuration = time.Minute
+	task := newTestTask(t, srv, "line 1")
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*200)
+	defer cancel()
+
+	err := task.Follow(ctx, &strings.Builder{})
+	if err != context.DeadlineExceeded {
+		t.Errorf("Follow: got %v, want %v", err, context.DeadlineExceeded)
+	}
+}
@@ -0,0 +1,79 @@
+package proxmox
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"strings"
+)
+
+// TLSOptions control how the certificate of the Proxmox node is verified.
+// Without any of them set, the certificate is not checked at all.
+type TLSOptions struct {
+	// VerifySSL verifies the certificate against the system CA pool or,
+	// if given, against CACert.
+	VerifySSL bool
+	// CACert is a PEM encoded CA bundle. Setting it implies VerifySSL.
+	CACert []byte
+	// Fingerprint is the SHA-256 fingerprint of the node certificate as
+	// shown in the Proxmox GUI, e.g. "AB:CD:...". The certificate is then
+	// accepted if and only if its fingerprint matches, which allows using
+	// self-signed certificates safely. It cannot be combined with CACert
+	// nor with WithFailover, as every node has its own certificate.
+	Fingerprint string
+}
+
+func (options TLSOptions) verify() bool {
+	return options.VerifySSL || len(options.CACert) > 0 || options.Fingerprint != ""
+}
+
+func (options TLSOptions) config() (*tls.Config, error) {
+	var config *tls.Config
+
+	if !options.verify() {
+		return &tls.Config{InsecureSkipVerify: true}, nil
+	}
+
+	if len(options.CACert) > 0 && options.Fingerprint != "" {
+		return nil, errors.New("CACert and Fingerprint are mutually exclusive.")
+	}
+	config = new(tls.Config)
+	if len(options.CACert) > 0 {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(options.CACert) {
+			return nil, errors.New("No certificates found in CA bundle.")
+		}
+		config.RootCAs = pool
+	}
+	if options.Fingerprint != "" {
+		fingerprint, err := hex.DecodeString(strings.ReplaceAll(strings.TrimSpace(options.Fingerprint), ":", ""))
+		if err != nil || len(fingerprint) != sha256.Size {
+			return nil, errors.New("Invalid SHA-256 fingerprint " + options.Fingerprint + ".")
+		}
+		// The chain is not verified, the pinned fingerprint replaces it.
+		config.InsecureSkipVerify = true
+		config.VerifyConnection = func(state tls.ConnectionState) error {
+			if len(state.PeerCertificates) == 0 {
+				return errors.New("No peer certificate presented.")
+			}
+			sum := sha256.Sum256(state.PeerCertificates[0].Raw)
+			if !bytes.Equal(sum[:], fingerprint) {
+				return errors.New("Certificate fingerprint " + formatFingerprint(sum[:]) + " does not match " + options.Fingerprint + ".")
+			}
+			return nil
+		}
+	}
+	return config, nil
+}
+
+func formatFingerprint(sum []byte) string {
+	var parts []string
+
+	for _, b := range sum {
+		parts = append(parts, strings.ToUpper(hex.EncodeToString([]byte{b})))
+	}
+	return strings.Join(parts, ":")
+}
@@ -0,0 +1,64 @@
+package proxmox
+
+import (
+	"encoding/pem"
+	"strings"
+	"testing"
+
+	"github.com/joernott/go-proxmox/proxmoxtest"
+)
+
+func TestTLS(t *testing.T) {
+	srv := newTestServer(t)
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	// All httptest servers share one certificate, so use a made up one.
+	wrong := strings.Repeat("AB:", 31) + "AB"
+
+	tests := []struct {
+		name          string
+		tls           TLSOptions
+		wantVerifySSL bool
+		wantErr       string
+	}{
+		{name: "no verification", tls: TLSOptions{}},
+		{name: "CA bundle", tls: TLSOptions{CACert: ca}, wantVerifySSL: true},
+		{name: "fingerprint", tls: TLSOptions{Fingerprint: srv.Fingerprint()}, wantVerifySSL: true},
+		{name: "lowercase fingerprint", tls: TLSOptions{Fingerprint: strings.ToLower(srv.Fingerprint())}, wantVerifySSL: true},
+		{name: "fingerprint mismatch", tls: TLSOptions{Fingerprint: wrong}, wantErr: "does not match " + wrong},
+		{name: "system CAs", tls: TLSOptions{VerifySSL: true}, wantErr: "certificate"},
+		{name: "invalid fingerprint", tls: TLSOptions{Fingerprint: "AB:CD"}, wantErr: "Invalid SHA-256 fingerprint AB:CD."},
+		{name: "empty CA bundle", tls: TLSOptions{CACert: []byte("no PEM")}, wantErr: "No certificates found in CA bundle."},
+		{name: "CA bundle and fingerprint", tls: TLSOptions{CACert: ca, Fingerprint: srv.Fingerprint()},
+			wantErr: "CACert and Fingerprint are mutually exclusive."},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			proxmox, err := New(srv.URL, WithPassword(proxmoxtest.DefaultUser, proxmoxtest.DefaultPassword), WithTLS(tt.tls))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("New: got %v, want an error containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("New: %v", err)
+			}
+			if proxmox.VerifySSL != tt.wantVerifySSL {
+				t.Errorf("VerifySSL = %v, want %v", proxmox.VerifySSL, tt.wantVerifySSL)
+			}
+			if _, err = proxmox.Nodes(); err != nil {
+				t.Errorf("Nodes: %v", err)
+			}
+		})
+	}
+}
+
+func TestTLSFingerprintWithFailover(t *testing.T) {
+	srv := newTestServer(t)
+
+	_, err := New(srv.URL, WithPassword(proxmoxtest.DefaultUser, proxmoxtest.DefaultPassword),
+		WithTLS(TLSOptions{Fingerprint: srv.Fingerprint()}), WithFailover("pve2"))
+	if err == nil || !strings.Contains(err.Error(), "pve-root-ca.pem") {
+		t.Errorf("New: got %v, want an error suggesting the cluster CA", err)
+	}
+}
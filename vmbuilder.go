@@ -0,0 +1,306 @@
+package proxmox
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var (
+	vmNameRegexp = regexp.MustCompile(`^[a-zA-Z0-9]([a-zA-Z0-9.-]*[a-zA-Z0-9])?$`)
+	vmSizeRegexp = regexp.MustCompile(`^([0-9]+(\.[0-9]+)?)([KMGTkmgt]?)$`)
+)
+
+var vmNetModels = map[string]bool{
+	"virtio":  true,
+	"e1000":   true,
+	"e1000e":  true,
+	"rtl8139": true,
+	"vmxnet3": true,
+}
+
+var vmOSTypes = map[string]bool{
+	"other": true, "wxp": true, "w2k": true, "w2k3": true, "w2k8": true,
+	"wvista": true, "win7": true, "win8": true, "win10": true, "win11": true,
+	"l24": true, "l26": true, "solaris": true,
+}
+
+// VMBuilder collects the settings of a new VM, see Node.NewVM. Invalid
+// settings are reported by Create. Limits depending on the node, like the
+// number of cores, are left to the API.
+type VMBuilder struct {
+	node     Node
+	vmid     string
+	options  map[string]string
+	storages map[string]string
+	errs     []error
+}
+
+// NewVM starts the definition of a VM to be created on the node. Without
+// further settings, the VM gets 1 socket, 1 core and 512 MB of memory.
+func (node Node) NewVM() *VMBuilder {
+	return &VMBuilder{
+		node:     node,
+		options:  make(map[string]string),
+		storages: make(map[string]string),
+	}
+}
+
+func (b *VMBuilder) fail(msg string) *VMBuilder {
+	b.errs = append(b.errs, errors.New(msg))
+	return b
+}
+
+// VMId sets the ID of the VM, otherwise the next free one is used.
+func (b *VMBuilder) VMId(id int) *VMBuilder {
+	if id < 100 || id > 999999999 {
+		return b.fail("Invalid VM ID " + strconv.Itoa(id) + ".")
+	}
+	b.vmid = strconv.Itoa(id)
+	return b
+}
+
+func (b *VMBuilder) Name(name string) *VMBuilder {
+	if !vmNameRegexp.MatchString(name) {
+		return b.fail("Invalid VM name " + name + ".")
+	}
+	b.options["name"] = name
+	return b
+}
+
+func (b *VMBuilder) Sockets(sockets int) *VMBuilder {
+	if sockets < 1 {
+		return b.fail("Invalid number of sockets " + strconv.Itoa(sockets) + ".")
+	}
+	b.options["sockets"] = strconv.Itoa(sockets)
+	return b
+}
+
+func (b *VMBuilder) Cores(cores int) *VMBuilder {
+	if cores < 1 {
+		return b.fail("Invalid number of cores " + strconv.Itoa(cores) + ".")
+	}
+	b.options["cores"] = strconv.Itoa(cores)
+	return b
+}
+
+// Memory sets the memory size in MB.
+func (b *VMBuilder) Memory(memory int) *VMBuilder {
+	if memory < 16 {
+		return b.fail("Invalid memory size " + strconv.Itoa(memory) + ".")
+	}
+	b.options["memory"] = strconv.Itoa(memory)
+	return b
+}
+
+// CPU sets the emulated CPU type, e.g. "host" or "x86-64-v2-AES".
+func (b *VMBuilder) CPU(cpu string) *VMBuilder {
+	b.options["cpu"] = cpu
+	return b
+}
+
+func (b *VMBuilder) OSType(ostype string) *VMBuilder {
+	if !vmOSTypes[ostype] {
+		return b.fail("Invalid OS type " + ostype + ".")
+	}
+	b.options["ostype"] = ostype
+	return b
+}
+
+// Disk adds a new disk of the given size, e.g. "32G", allocated on storage.
+// Sizes without unit are in bytes. The API allocates whole GiB, so the size is
+// rounded up, e.g. "500M" to 1 GiB.
+func (b *VMBuilder) Disk(key string, storage string, size string) *VMBuilder {
+	var gib float64
+
+	if !isDiskKey(key) {
+		return b.fail("Invalid disk " + key + ".")
+	}
+	if storage == "" {
+		return b.fail("No storage given for " + key + ".")
+	}
+	m := vmSizeRegexp.FindStringSubmatch(size)
+	if m == nil {
+		return b.fail("Invalid size " + size + " for disk " + key + ".")
+	}
+	gib, _ = strconv.ParseFloat(m[1], 64)
+	switch strings.ToUpper(m[3]) {
+	case "":
+		gib = gib / (1 << 30)
+	case "K":
+		gib = gib / (1 << 20)
+	case "M":
+		gib = gib / (1 << 10)
+	case "T":
+		gib = gib * (1 << 10)
+	}
+	if gib <= 0 {
+		return b.fail("Invalid size " + size + " for disk " + key + ".")
+	}
+	b.options[key] = storage + ":" + strconv.FormatFloat(math.Ceil(gib), 'f', 0, 64)
+	b.storages[storage] = "images"
+	return b
+}
+
+// Net adds a network device on bridge. A vlan of 0 means untagged.
+func (b *VMBuilder) Net(key string, model string, bridge string, vlan int) *VMBuilder {
+	var n int
+	var err error
+
+	if !strings.HasPrefix(key, "net") {
+		return b.fail("Invalid network device " + key + ".")
+	}
+	n, err = strconv.Atoi(strings.TrimPrefix(key, "net"))
+	if err != nil || n < 0 || n >= qemuMaxNet {
+		return b.fail("Invalid network device " + key + ".")
+	}
+	if !vmNetModels[model] {
+		return b.fail("Invalid network model " + model + " for " + key + ".")
+	}
+	if bridge == "" {
+		return b.fail("No bridge given for " + key + ".")
+	}
+	if vlan < 0 || vlan > 4094 {
+		return b.fail("Invalid VLAN " + strconv.Itoa(vlan) + " for " + key + ".")
+	}
+	b.options[key] = model + ",bridge=" + bridge
+	if vlan > 0 {
+		b.options[key] = b.options[key] + ",tag=" + strconv.Itoa(vlan)
+	}
+	return b
+}
+
+// CDROM attaches the ISO image, e.g. "local:iso/debian-12.iso", as ide2.
+func (b *VMBuilder) CDROM(iso string) *VMBuilder {
+	var storage string
+
+	if i := strings.Index(iso, ":"); i > 0 {
+		storage = iso[0:i]
+	}
+	if storage == "" {
+		return b.fail("Invalid ISO image " + iso + ".")
+	}
+	b.options["ide2"] = iso + ",media=cdrom"
+	b.storages[storage] = "iso"
+	return b
+}
+
+func (b *VMBuilder) SCSIHW(scsihw string) *VMBuilder {
+	b.options["scsihw"] = scsihw
+	return b
+}
+
+func (b *VMBuilder) OnBoot(onboot bool) *VMBuilder {
+	b.options["onboot"] = boolString(onboot)
+	return b
+}
+
+func (b *VMBuilder) Pool(pool string) *VMBuilder {
+	b.options["pool"] = pool
+	return b
+}
+
+func (b *VMBuilder) Description(description string) *VMBuilder {
+	b.options["description"] = description
+	return b
+}
+
+// Option sets any other configuration key not covered by the builder.
+func (b *VMBuilder) Option(key string, value string) *VMBuilder {
+	b.options[key] = value
+	return b
+}
+
+func (b *VMBuilder) Create() (Task, error) {
+	return b.CreateCtx(context.Background())
+}
+
+// CreateCtx checks the settings and the storages used, allocates a VM ID if
+// none was set and starts creating the VM. The ID of the returned task is the
+// VM ID.
+func (b *VMBuilder) CreateCtx(ctx context.Context) (Task, error) {
+	var err error
+	var storageList StorageList
+	var storage Storage
+	var form url.Values
+	var names []string
+	var target string
+	var UPid flexString
+	var ok bool
+	var vmid string
+
+	if len(b.errs) > 0 {
+		return Task{}, errors.Join(b.errs...)
+	}
+
+	if len(b.storages) > 0 {
+		storageList, err = b.node.StoragesCtx(ctx)
+		if err != nil {
+			return Task{}, err
+		}
+		for name := range b.storages {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if storage, ok = storageList[name]; !ok {
+				return Task{}, errors.New("Storage " + name + " not found on node " + b.node.Node + ".")
+			}
+			if !hasContent(storage.Content, b.storages[name]) {
+				return Task{}, errors.New("Storage " + name + " does not hold " + b.storages[name] + ".")
+			}
+		}
+	}
+
+	vmid = b.vmid
+	if vmid == "" {
+		vmid, err = nextVMId(ctx, b.node.Proxmox)
+		if err != nil {
+			return Task{}, err
+		}
+	}
+	form = url.Values{"vmid": {vmid}}
+	for k, v := range b.options {
+		form.Set(k, v)
+	}
+
+	target = "nodes/" + b.node.Node + "/qemu"
+	err = b.node.Proxmox.Do(ctx, "POST", target, form, &UPid)
+	if err != nil {
+		logger(b.node.Proxmox).DebugContext(ctx, "Error creating VM", "node", b.node.Node, "vmid", vmid, "error", err)
+		return Task{}, err
+	}
+	return Task{UPid: string(UPid), ID: vmid, proxmox: b.node.Proxmox}, nil
+}
+
+func isDiskKey(key string) bool {
+	for bus, count := range qemuDiskBuses {
+		if !strings.HasPrefix(key, bus) {
+			continue
+		}
+		n, err := strconv.Atoi(strings.TrimPrefix(key, bus))
+		return err == nil && n >= 0 && n < count
+	}
+	return false
+}
+
+func hasContent(content string, kind string) bool {
+	for _, c := range strings.Split(content, ",") {
+		if c == kind {
+			return true
+		}
+	}
+	return false
+}
+
+func boolString(b bool) string {
+	if b {
+		return "1"
+	}
+	return "0"
+}
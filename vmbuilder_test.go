@@ -0,0 +1,112 @@
+package proxmox
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestVMBuilderValidation(t *testing.T) {
+	proxmox := ProxMox{}
+	node := Node{Node: "pve", Proxmox: proxmox}
+
+	tests := []struct {
+		name    string
+		builder *VMBuilder
+		want    string
+	}{
+		{name: "vmid", builder: node.NewVM().VMId(99), want: "Invalid VM ID 99."},
+		{name: "name", builder: node.NewVM().Name("web_1"), want: "Invalid VM name web_1."},
+		{name: "sockets", builder: node.NewVM().Sockets(0), want: "Invalid number of sockets 0."},
+		{name: "cores", builder: node.NewVM().Cores(-1), want: "Invalid number of cores -1."},
+		{name: "memory", builder: node.NewVM().Memory(8), want: "Invalid memory size 8."},
+		{name: "ostype", builder: node.NewVM().OSType("linux"), want: "Invalid OS type linux."},
+		{name: "disk key", builder: node.NewVM().Disk("scsi31", "local", "32G"), want: "Invalid disk scsi31."},
+		{name: "disk storage", builder: node.NewVM().Disk("scsi0", "", "32G"), want: "No storage given for scsi0."},
+		{name: "disk size", builder: node.NewVM().Disk("scsi0", "local", "32GB"), want: "Invalid size 32GB for disk scsi0."},
+		{name: "empty disk", builder: node.NewVM().Disk("scsi0", "local", "0G"), want: "Invalid size 0G for disk scsi0."},
+		{name: "net key", builder: node.NewVM().Net("eth0", "virtio", "vmbr0", 0), want: "Invalid network device eth0."},
+		{name: "net model", builder: node.NewVM().Net("net0", "ne2k", "vmbr0", 0), want: "Invalid network model ne2k for net0."},
+		{name: "bridge", builder: node.NewVM().Net("net0", "virtio", "", 0), want: "No bridge given for net0."},
+		{name: "vlan", builder: node.NewVM().Net("net0", "virtio", "vmbr0", 4095), want: "Invalid VLAN 4095 for net0."},
+		{name: "cdrom", builder: node.NewVM().CDROM("debian-12.iso"), want: "Invalid ISO image debian-12.iso."},
+		{name: "all errors", builder: node.NewVM().Sockets(0).Cores(0), want: "Invalid number of sockets 0.\nInvalid number of cores 0."},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Invalid settings fail before any request is sent.
+			_, err := tt.builder.Create()
+			if err == nil || err.Error() != tt.want {
+				t.Errorf("Create: got %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestVMBuilderCreate(t *testing.T) {
+	var forms []url.Values
+
+	s := newStubServer(t)
+	s.handleData("GET nodes/pve/storage", `[{"storage":"local","type":"dir","content":"iso,vztmpl,backup","active":1},
+		{"storage":"local-lvm","type":"lvmthin","content":"images,rootdir","active":1}]`)
+	s.handleData("GET cluster/nextid", `"104"`)
+	s.handle("POST nodes/pve/qemu", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		forms = append(forms, r.PostForm)
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"data":"UPID:pve:00001234:00005678:65F0A000:qmcreate:%s:root@pam:"}`, r.PostForm.Get("vmid"))
+	})
+	proxmox := newStubClient(t, s)
+	node := Node{Node: "pve", Proxmox: proxmox}
+
+	b := node.NewVM().Name("web").Sockets(1).Cores(4).Memory(4096).OSType("l26").
+		Disk("scsi0", "local-lvm", "32g").Disk("scsi1", "local-lvm", "500M").Disk("virtio0", "local-lvm", "1.5T").
+		Net("net0", "virtio", "vmbr0", 20).CDROM("local:iso/debian-12.iso").OnBoot(true).Option("agent", "1")
+	task, err := b.Create()
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if task.ID != "104" || !strings.Contains(task.UPid, ":qmcreate:104:") {
+		t.Errorf("Create = task %s for %s, want one for 104", task.UPid, task.ID)
+	}
+	want := url.Values{
+		"vmid":    {"104"},
+		"name":    {"web"},
+		"sockets": {"1"},
+		"cores":   {"4"},
+		"memory":  {"4096"},
+		"ostype":  {"l26"},
+		"scsi0":   {"local-lvm:32"},
+		"scsi1":   {"local-lvm:1"},
+		"virtio0": {"local-lvm:1536"},
+		"net0":    {"virtio,bridge=vmbr0,tag=20"},
+		"ide2":    {"local:iso/debian-12.iso,media=cdrom"},
+		"onboot":  {"1"},
+		"agent":   {"1"},
+	}
+	if !reflect.DeepEqual(forms[0], want) {
+		t.Errorf("Create sent %v, want %v", forms[0], want)
+	}
+
+	// The allocated ID is not kept, a second Create asks again.
+	s.handleData("GET cluster/nextid", `"105"`)
+	task, err = b.Create()
+	if err != nil {
+		t.Fatalf("second Create: %v", err)
+	}
+	if task.ID != "105" || forms[1].Get("vmid") != "105" {
+		t.Errorf("second Create = %s, sent vmid %s, want 105", task.ID, forms[1].Get("vmid"))
+	}
+
+	_, err = node.NewVM().VMId(200).Disk("scsi0", "local", "32G").Create()
+	if err == nil || err.Error() != "Storage local does not hold images." {
+		t.Errorf("Create with a disk on local: got %v", err)
+	}
+	_, err = node.NewVM().VMId(200).CDROM("nfs:iso/debian-12.iso").Create()
+	if err == nil || err.Error() != "Storage nfs not found on node pve." {
+		t.Errorf("Create with an ISO on nfs: got %v", err)
+	}
+}